@@ -1,21 +1,27 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"expvar"
 	"fmt"
 	newrelic "github.com/newrelic/go-agent"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/codefresh-io/go-infra/pkg/logger"
-	"github.com/codefresh-io/nomios/pkg/azure"
-	"github.com/codefresh-io/nomios/pkg/dockerhub"
+	"github.com/codefresh-io/nomios/pkg/deadletter"
+	"github.com/codefresh-io/nomios/pkg/dedup"
 	"github.com/codefresh-io/nomios/pkg/event"
 	"github.com/codefresh-io/nomios/pkg/hermes"
-	"github.com/codefresh-io/nomios/pkg/jfrog"
-	"github.com/codefresh-io/nomios/pkg/jfroghelm"
-	"github.com/codefresh-io/nomios/pkg/quay"
+	"github.com/codefresh-io/nomios/pkg/outbox"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/codefresh-io/nomios/pkg/registry"
 	"github.com/codefresh-io/nomios/pkg/version"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -24,6 +30,20 @@ import (
 
 var nrApp newrelic.Application
 
+// graceful server shutdown timeout
+const shutdownTimeout = 30 * time.Second
+
+// Hermes API request defaults of synchronous delivery (no outbox): retries run while webhook request waits,
+// so they are kept within registry webhook timeouts (about 10 seconds in the worst case)
+const (
+	syncHermesTimeout    = 3 * time.Second
+	syncHermesRetries    = 1
+	syncHermesMaxBackoff = time.Second
+)
+
+// placeholder Hermes API token, never accepted by API routes
+const defaultToken = "TOKEN"
+
 // HermesDryRun dry run stub
 type HermesDryRun struct {
 }
@@ -31,6 +51,12 @@ type HermesDryRun struct {
 // PublicDNS public dns name for Codefresh environment
 var PublicDNS string
 
+// hermesAPI Hermes API endpoint, nil on dry run
+var hermesAPI *hermes.APIEndpoint
+
+// deadLetters dead letter store, nil if not configured
+var deadLetters *deadletter.Store
+
 // TriggerEvent dry run version
 func (m *HermesDryRun) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
 	fmt.Println(eventURI)
@@ -61,19 +87,7 @@ Copyright © Codefresh.io`, version.ASCIILogo)
 	app.Commands = []cli.Command{
 		{
 			Name: "server",
-			Flags: []cli.Flag{
-				cli.StringFlag{
-					Name:   "hermes",
-					Usage:  "Codefresh Hermes service",
-					Value:  "http://local.codefresh.io:9011",
-					EnvVar: "HERMES_SERVICE",
-				},
-				cli.StringFlag{
-					Name:   "token, t",
-					Usage:  "Codefresh Hermes API token",
-					Value:  "TOKEN",
-					EnvVar: "HERMES_TOKEN",
-				},
+			Flags: append(append(hermesFlags(), []cli.Flag{
 				cli.StringFlag{
 					Name:   "dns, n",
 					Usage:  "Public DNS name for the Codefresh environment",
@@ -90,13 +104,95 @@ Copyright © Codefresh.io`, version.ASCIILogo)
 					Name:  "dry-run",
 					Usage: "do not execute commands, just log",
 				},
-			},
+				cli.StringFlag{
+					Name:   "outbox-dir",
+					Usage:  "directory for durable event outbox; events are persisted before webhook is acknowledged and delivered to Hermes in background (synchronous delivery if empty)",
+					EnvVar: "OUTBOX_DIR",
+				},
+				cli.DurationFlag{
+					Name:   "outbox-retry",
+					Usage:  "outbox delivery retry interval",
+					Value:  30 * time.Second,
+					EnvVar: "OUTBOX_RETRY",
+				},
+				cli.StringFlag{
+					Name:   "dead-letter-dir",
+					Usage:  "directory for dead letter store; events, that failed delivery to Hermes, are kept for replay",
+					EnvVar: "DEAD_LETTER_DIR",
+				},
+				cli.IntFlag{
+					Name:   "outbox-max-attempts",
+					Usage:  "move outbox event to dead letter store after this number of failed Hermes requests (requires --dead-letter-dir; 0 to retry forever)",
+					Value:  50,
+					EnvVar: "OUTBOX_MAX_ATTEMPTS",
+				},
+				cli.DurationFlag{
+					Name:   "dedup-ttl",
+					Usage:  "suppress duplicate events (webhook retries, multi-platform image notifications), triggered within this time window (0 to disable)",
+					Value:  10 * time.Minute,
+					EnvVar: "DEDUP_TTL",
+				},
+				cli.StringFlag{
+					Name:   "registry-credentials",
+					Usage:  "JSON file with registry credentials per provider/namespace; push events are enriched with manifest digest, media type and platforms, querying registry v2 API",
+					EnvVar: "REGISTRY_CREDENTIALS",
+				},
+				cli.DurationFlag{
+					Name:   "registry-timeout",
+					Usage:  "registry v2 API request timeout",
+					Value:  10 * time.Second,
+					EnvVar: "REGISTRY_TIMEOUT",
+				},
+				cli.DurationFlag{
+					Name:   "enrich-timeout",
+					Usage:  "total event enrichment time of webhook request; events, not enriched in time, are triggered as is (0 for no limit)",
+					Value:  provider.DefaultEnrichTimeout,
+					EnvVar: "ENRICH_TIMEOUT",
+				},
+			}...), provider.Flags()...),
 			Usage: "start nomios webhook handler server",
 			Description: `Run DockerHub WebHook handler server. Process and send normalized event payload to the Codefresh Hermes trigger manager service to invoke associated Codefresh pipelines.
 			
 		Event URI Pattern: registry:dockerhub:{{namespace}}:{{name}}:push`,
 			Action: runServer,
 		},
+		{
+			Name: "replay",
+			Flags: append(hermesFlags(), []cli.Flag{
+				cli.StringFlag{
+					Name:   "dead-letter-dir",
+					Usage:  "dead letter store directory",
+					EnvVar: "DEAD_LETTER_DIR",
+				},
+				cli.StringFlag{
+					Name:  "id",
+					Usage: "comma separated dead letter ids",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "replay dead letters since RFC3339 time or duration ago (2018-05-01T10:00:00Z or 24h)",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "replay dead letters until RFC3339 time or duration ago",
+				},
+				cli.StringFlag{
+					Name:  "uri",
+					Usage: "event URI glob pattern (registry:dockerhub:codefresh:*)",
+				},
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "replay already replayed dead letters too",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "list matching dead letters, do not replay them",
+				},
+			}...),
+			Usage:       "replay events from dead letter store",
+			Description: "Send events, that failed delivery to the Codefresh Hermes trigger manager service, again. Select dead letters by id, time range or event URI glob; successfully replayed dead letters are skipped on next replay, unless --all is set.",
+			Action:      runReplay,
+		},
 	}
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
@@ -172,25 +268,121 @@ func before(c *cli.Context) error {
 	return nil
 }
 
+// Hermes API endpoint command line flags
+func hermesFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "hermes",
+			Usage:  "Codefresh Hermes service",
+			Value:  "http://local.codefresh.io:9011",
+			EnvVar: "HERMES_SERVICE",
+		},
+		cli.StringFlag{
+			Name:   "token, t",
+			Usage:  "Codefresh Hermes API token",
+			Value:  defaultToken,
+			EnvVar: "HERMES_TOKEN",
+		},
+		cli.DurationFlag{
+			Name:   "hermes-timeout",
+			Usage:  "Hermes API request timeout (3s by default without outbox)",
+			Value:  10 * time.Second,
+			EnvVar: "HERMES_TIMEOUT",
+		},
+		cli.IntFlag{
+			Name:   "hermes-retries",
+			Usage:  "max retries of failed Hermes API request (network error, 5xx or 429 response; 1 by default without outbox)",
+			Value:  3,
+			EnvVar: "HERMES_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   "hermes-backoff",
+			Usage:  "initial Hermes API retry backoff; doubled, with jitter, on every retry",
+			Value:  500 * time.Millisecond,
+			EnvVar: "HERMES_BACKOFF",
+		},
+		cli.IntFlag{
+			Name:   "hermes-breaker-threshold",
+			Usage:  "consecutive failed Hermes API requests to open circuit breaker (0 to disable)",
+			Value:  5,
+			EnvVar: "HERMES_BREAKER_THRESHOLD",
+		},
+		cli.DurationFlag{
+			Name:   "hermes-breaker-cooldown",
+			Usage:  "time to fail fast Hermes API requests, while circuit breaker is open",
+			Value:  30 * time.Second,
+			EnvVar: "HERMES_BREAKER_COOLDOWN",
+		},
+	}
+}
+
+// newHermesEndpoint create Hermes API endpoint from command line flags; synchronous delivery (webhook
+// waits for Hermes) has lower timeout and retries defaults
+func newHermesEndpoint(c *cli.Context, synchronous bool) *hermes.APIEndpoint {
+	// add http protocol, if missing
+	hermesSvcName := c.String("hermes")
+	if !strings.HasPrefix(hermesSvcName, "http://") && !strings.HasPrefix(hermesSvcName, "https://") {
+		hermesSvcName = "http://" + hermesSvcName
+	}
+	options := hermes.DefaultOptions()
+	options.Timeout = c.Duration("hermes-timeout")
+	options.Retries = c.Int("hermes-retries")
+	options.Backoff = c.Duration("hermes-backoff")
+	options.BreakerThreshold = c.Int("hermes-breaker-threshold")
+	options.BreakerCooldown = c.Duration("hermes-breaker-cooldown")
+	if synchronous {
+		if !c.IsSet("hermes-timeout") {
+			options.Timeout = syncHermesTimeout
+		}
+		if !c.IsSet("hermes-retries") {
+			options.Retries = syncHermesRetries
+		}
+		options.MaxBackoff = syncHermesMaxBackoff
+	}
+	return hermes.NewHermesEndpointWithOptions(hermesSvcName, c.String("token"), options)
+}
+
 // start trigger manager server
 func runServer(c *cli.Context) error {
 	fmt.Println()
 	fmt.Println(version.ASCIILogo)
 
-	// bind dockerhub to hermes API endpoint
-	var hub *dockerhub.DockerHub
+	// bind providers to hermes API endpoint
 	var hermesEndpoint hermes.Service
 	if c.Bool("dry-run") {
-		hub = dockerhub.NewDockerHub(&HermesDryRun{})
+		hermesEndpoint = &HermesDryRun{}
 	} else {
-		// add http protocol, if missing
-		hermesSvcName := c.String("hermes")
-		if !strings.HasPrefix(hermesSvcName, "http://") {
-			hermesSvcName = "http://" + hermesSvcName
+		hermesAPI = newHermesEndpoint(c, c.String("outbox-dir") == "")
+		hermesEndpoint = hermesAPI
+	}
+
+	// keep events, that failed delivery, in dead letter store
+	if dir := c.String("dead-letter-dir"); dir != "" {
+		var err error
+		if deadLetters, err = deadletter.Open(dir); err != nil {
+			log.WithError(err).Error("failed to open dead letter store")
+			return err
+		}
+		defer deadLetters.Close()
+	}
+
+	// persist events in outbox, delivering them to hermes in background
+	if dir := c.String("outbox-dir"); dir != "" {
+		ob, err := outbox.Open(dir, hermesEndpoint, c.Duration("outbox-retry"))
+		if err != nil {
+			log.WithError(err).Error("failed to open event outbox")
+			return err
 		}
-		log.Debug("setting DockerHub webhook endpoint")
-		hermesEndpoint = hermes.NewHermesEndpoint(hermesSvcName, c.String("token"))
-		hub = dockerhub.NewDockerHub(hermes.NewHermesEndpoint(hermesSvcName, c.String("token")))
+		defer ob.Close()
+		if deadLetters != nil {
+			ob.SetDeadLetters(deadLetters, c.Int("outbox-max-attempts"))
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		go ob.Run(stop)
+		hermesEndpoint = ob
+	} else if deadLetters != nil {
+		hermesEndpoint = deadletter.NewRecorder(hermesEndpoint, deadLetters)
 	}
 
 	// get public DNS name
@@ -200,20 +392,43 @@ func runServer(c *cli.Context) error {
 	router := gin.New()
 	router.Use(gin.Recovery())
 
-	quayHook := quay.NewQuay(hermesEndpoint)
-	jfrogHook := jfrog.NewJFrog(hermesEndpoint)
-	jfrogHelmHook := jfroghelm.NewJFrog(hermesEndpoint)
-	azureHook := azure.NewAzure(hermesEndpoint)
+	// configure providers
+	if err := provider.Configure(c); err != nil {
+		log.WithError(err).Error("failed to configure providers")
+		return err
+	}
 
-	router.POST("/nomios/dockerhub", gin.Logger(), hub.HandleWebhook)
-	router.POST("/dockerhub", gin.Logger(), hub.HandleWebhook)
+	// enrich push events with registry image details
+	if file := c.String("registry-credentials"); file != "" {
+		credentials, err := registry.LoadCredentials(file)
+		if err != nil {
+			log.WithError(err).Error("failed to load registry credentials")
+			return err
+		}
+		provider.AddEnricher(registry.NewEnricher(credentials, c.Duration("registry-timeout")))
+	}
 
-	router.POST("/nomios/quay", gin.Logger(), quayHook.HandleWebhook)
-	router.POST("/nomios/jfrog", gin.Logger(), jfrogHook.HandleWebhook)
-	router.POST("/nomios/azure", gin.Logger(), azureHook.HandleWebhook)
+	// keep webhook response within registry webhook timeouts
+	provider.SetEnrichTimeout(c.Duration("enrich-timeout"))
 
-	router.POST("/nomios/helm/jfrog", gin.Logger(), jfrogHelmHook.HandleWebhook)
-	router.GET("/nomios/helm/jfrog", gin.Logger(), jfrogHelmHook.HandleWebhook)
+	// suppress duplicate events
+	if ttl := c.Duration("dedup-ttl"); ttl > 0 {
+		provider.SetDedup(dedup.New(ttl))
+	}
+
+	// webhook routes for all registered providers
+	for _, p := range provider.Providers() {
+		path := provider.Path(p)
+		log.WithField("path", path).Debug("setting webhook endpoint")
+		router.POST(path, gin.Logger(), provider.NewHandler(p, hermesEndpoint))
+	}
+	// legacy webhook routes
+	if p, ok := provider.Lookup("registry", "dockerhub"); ok {
+		router.POST("/dockerhub", gin.Logger(), provider.NewHandler(p, hermesEndpoint))
+	}
+	if p, ok := provider.Lookup("helm", "jfrog"); ok {
+		router.GET(provider.Path(p), gin.Logger(), provider.NewHandler(p, hermesEndpoint))
+	}
 
 	// event info route
 	router.GET("/nomios/event/:uri/:secret", gin.Logger(), getEventInfo)
@@ -223,9 +438,18 @@ func runServer(c *cli.Context) error {
 	router.POST("/event/:uri/:secret/:credentials", gin.Logger(), subscribeToEvent)
 	router.DELETE("/nomios/event/:uri/:credentials", gin.Logger(), unsubscribeFromEvent)
 	router.DELETE("/event/:uri/:credentials", gin.Logger(), unsubscribeFromEvent)
+	// dead letters route, authorized with Hermes API token; disabled until token is configured
+	if token := c.String("token"); deadLetters != nil && token != "" && token != defaultToken {
+		router.GET("/nomios/deadletters", gin.Logger(), requireToken(token), getDeadLetters)
+		router.GET("/deadletters", gin.Logger(), requireToken(token), getDeadLetters)
+	} else if deadLetters != nil {
+		log.Warn("Hermes API token is not configured: dead letters API is disabled")
+	}
 	// status routes
 	router.GET("/nomios/health", getHealth)
 	router.GET("/health", getHealth)
+	router.GET("/nomios/metrics", getMetrics)
+	router.GET("/metrics", getMetrics)
 	router.GET("/nomios/version", getVersion)
 	router.GET("/version", getVersion)
 	router.GET("/nomios/ping", ping)
@@ -238,7 +462,25 @@ func runServer(c *cli.Context) error {
 	// use RawPath: the url.RawPath will be used to find parameters
 	router.UseRawPath = true
 	// start router server
-	return router.Run(fmt.Sprintf(":%d", port))
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: router}
+	// on SIGTERM or SIGINT, stop accepting webhooks and wait for in-flight requests
+	shutdown := make(chan error, 1)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		sig := <-signals
+		log.WithField("signal", sig).Info("shutting down nomios server")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	err := <-shutdown
+	// trigger events buffered in coalescing windows (persisted in outbox, when configured)
+	provider.Flush()
+	return err
 }
 
 func getEventInfo(c *gin.Context) {
@@ -277,8 +519,107 @@ func unsubscribeFromEvent(c *gin.Context) {
 	c.Status(http.StatusNotImplemented)
 }
 
+// replay events from dead letter store
+func runReplay(c *cli.Context) error {
+	dir := c.String("dead-letter-dir")
+	if dir == "" {
+		return fmt.Errorf("missing dead letter store directory: set --dead-letter-dir")
+	}
+	filter, err := deadletter.ParseFilter(c.String("id"), c.String("since"), c.String("until"), c.String("uri"))
+	if err != nil {
+		return err
+	}
+	filter.Pending = !c.Bool("all")
+	store, err := deadletter.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if c.Bool("dry-run") {
+		letters, err := store.List(filter)
+		if err != nil {
+			return err
+		}
+		for _, l := range letters {
+			fmt.Printf("%d\t%s\t%s\t%s\n", l.ID, l.Time.Format(time.RFC3339), l.EventURI, l.Error)
+		}
+		return nil
+	}
+
+	results, err := store.Replay(newHermesEndpoint(c, false), filter)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("%d\t%s\tFAILED: %v\n", r.Letter.ID, r.Letter.EventURI, r.Err)
+		} else {
+			fmt.Printf("%d\t%s\tOK\n", r.Letter.ID, r.Letter.EventURI)
+		}
+	}
+	fmt.Printf("replayed %d of %d dead letters\n", len(results)-failed, len(results))
+	if failed > 0 {
+		return fmt.Errorf("failed to replay %d dead letters", failed)
+	}
+	return nil
+}
+
+func getDeadLetters(c *gin.Context) {
+	filter, err := deadletter.ParseFilter(c.Query("id"), c.Query("since"), c.Query("until"), c.Query("uri"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Pending = c.Query("pending") == "true"
+	letters, err := deadLetters.List(filter)
+	if err != nil {
+		log.WithError(err).Error("failed to list dead letters")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// do not expose trigger secrets
+	redacted := make([]*deadletter.Letter, 0, len(letters))
+	for _, l := range letters {
+		redacted = append(redacted, l.Redacted())
+	}
+	c.JSON(http.StatusOK, redacted)
+}
+
+// requireToken authorize request with API token in "Authorization" header (optional "Bearer " prefix)
+func requireToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			log.WithField("path", c.Request.URL.Path).Warn("unauthorized API request")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
 func getHealth(c *gin.Context) {
-	c.Status(http.StatusOK)
+	health := gin.H{"status": "ok"}
+	if hermesAPI != nil {
+		health["hermes"] = gin.H{"circuit": hermesAPI.CircuitState()}
+	}
+	c.JSON(http.StatusOK, health)
+}
+
+// expvar variables, exposed by metrics endpoint; the rest (cmdline with flag secrets, memstats) stays private
+var metricVars = []string{"dedup"}
+
+func getMetrics(c *gin.Context) {
+	var vars []string
+	for _, name := range metricVars {
+		if v := expvar.Get(name); v != nil {
+			vars = append(vars, fmt.Sprintf("%q: %s", name, v.String()))
+		}
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", []byte("{"+strings.Join(vars, ", ")+"}"))
 }
 
 func getVersion(c *gin.Context) {
@@ -0,0 +1,19 @@
+package main
+
+// register webhook event providers
+import (
+	_ "github.com/codefresh-io/nomios/pkg/azure"
+	_ "github.com/codefresh-io/nomios/pkg/chartmuseum"
+	_ "github.com/codefresh-io/nomios/pkg/distribution"
+	_ "github.com/codefresh-io/nomios/pkg/dockerhub"
+	_ "github.com/codefresh-io/nomios/pkg/ecr"
+	_ "github.com/codefresh-io/nomios/pkg/gcr"
+	_ "github.com/codefresh-io/nomios/pkg/ghcr"
+	_ "github.com/codefresh-io/nomios/pkg/gitlab"
+	_ "github.com/codefresh-io/nomios/pkg/harbor"
+	_ "github.com/codefresh-io/nomios/pkg/jfrog"
+	_ "github.com/codefresh-io/nomios/pkg/jfrogartifact"
+	_ "github.com/codefresh-io/nomios/pkg/jfroghelm"
+	_ "github.com/codefresh-io/nomios/pkg/nexus"
+	_ "github.com/codefresh-io/nomios/pkg/quay"
+)
@@ -3,98 +3,195 @@ package azure
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"strings"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
-	"net/http"
-	"strings"
 )
 
-// azure struct
+// azure Azure Container Registry webhook provider
+//
+// Both registry and helm instances accept image and chart actions; event URI type depends on action.
 type azure struct {
-	hermesSvc hermes.Service
+	eventType string
 }
 
 type webhookPayload struct {
-	Action    string `json:action`
-	Timestamp string `json:timestamp`
+	Action    string `json:"action"`
+	Timestamp string `json:"timestamp"`
 	Target    struct {
-		Repository string `json:repository`
-		Tag        string `json:tag`
-		Name       string
-	} `json:target`
+		MediaType  string `json:"mediaType"`
+		Size       int64  `json:"size"`
+		Digest     string `json:"digest"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+		Name       string `json:"name"`
+		Version    string `json:"version"`
+	} `json:"target"`
 	Request struct {
-		Host string `json:host`
-	} `json:request`
+		Host string `json:"host"`
+	} `json:"request"`
+}
+
+// ACR webhook action mapping to event URI type and action
+type eventAction struct {
+	eventType string
+	action    string
+}
+
+// ACR webhook test event, sent by "Ping" webhook command
+const pingAction = "ping"
+
+var actions = map[string]eventAction{
+	"push":         {"registry", "push"},
+	"delete":       {"registry", "delete"},
+	"quarantine":   {"registry", "quarantine"},
+	"chart_push":   {"helm", "push"},
+	"chart_delete": {"helm", "delete"},
+}
+
+func init() {
+	provider.Register(NewAzure("registry"))
+	provider.Register(NewAzure("helm"))
 }
 
-// NewAzure new azure handler
-func NewAzure(svc hermes.Service) *azure {
-	return &azure{svc}
+// NewAzure new azure provider for event type (registry or helm)
+func NewAzure(eventType string) *azure {
+	return &azure{eventType: eventType}
 }
 
-func constructEventURI(payload *webhookPayload, account string) string {
-	ns := strings.Split(payload.Request.Host, ".")
-	uri := fmt.Sprintf("registry:azure:%s:%s:push", ns[0], payload.Target.Repository)
-	if account != "" {
-		uri = fmt.Sprintf("%s:%s", uri, account)
+// Name provider name
+func (d *azure) Name() string {
+	return "azure"
+}
+
+// EventType provider event type
+func (d *azure) EventType() string {
+	return d.eventType
+}
+
+// EventURI construct Azure event URI; type depends on action
+func (d *azure) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      event.Variables["type"],
+		Provider:  "azure",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    event.Variables["action"],
+		Account:   account,
 	}
-	return uri
+	return uri.String()
 }
 
-// HandleWebhook handle azure webhook
-func (d *azure) HandleWebhook(c *gin.Context) {
-	log.Debug("Got azure webhook event")
+// URIRule event URI validation rule
+func (d *azure) URIRule() eventuri.Rule {
+	if d.eventType == "helm" {
+		return eventuri.Rule{
+			Actions: []string{"push", "delete"},
+		}
+	}
+	return eventuri.Rule{
+		NestedName: true,
+		Actions:    []string{"push", "delete", "quarantine"},
+	}
+}
 
-	payload := webhookPayload{}
+// Describe Azure event info
+func (d *azure) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "Azure",
+		SettingsLink: "https://codefresh.io/docs/docs/configure-ci-cd-pipeline/triggers/azure-triggers/",
+	}
+}
 
+// ParsePayload parse Azure webhook payload; ping test events are acknowledged without events
+func (d *azure) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	payload := webhookPayload{}
 	if err := c.BindJSON(&payload); err != nil {
 		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
-
-	var s []string = strings.Split(payload.Target.Repository, "/")
-	payload.Target.Name = strings.Join(s[1:len(s)], "")
-
-	if payload.Action != "push" {
+	log.WithFields(log.Fields{
+		"action":     payload.Action,
+		"host":       payload.Request.Host,
+		"repository": payload.Target.Repository,
+	}).Debug("Got azure webhook event")
+
+	if payload.Action == pingAction {
+		log.Debug("Got azure webhook ping event")
+		return nil, nil
+	}
+	action, ok := actions[payload.Action]
+	if !ok {
 		log.Debug(fmt.Sprintf("Skip event %s", payload.Action))
-		return
+		return nil, nil
+	}
+
+	registry, region, err := parseLoginServer(payload.Request.Host)
+	if err != nil {
+		return nil, err
+	}
+	name := payload.Target.Repository
+	tag := payload.Target.Tag
+	if action.eventType == "helm" {
+		name = payload.Target.Name
+		tag = strings.TrimSuffix(payload.Target.Version, ".tgz")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("missing target repository in azure %s event", payload.Action)
 	}
 
-	event := hermes.NewNormalizedEvent()
-	eventURI := constructEventURI(&payload, c.Query("account"))
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		log.WithError(err).Error("Failed to covert webhook payload structure to JSON")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
+
+	event := hermes.NewNormalizedEvent()
 	// keep original JSON
 	event.Original = string(payloadJSON)
 
-	// get image push details
+	// get image or chart details
 	event.Variables["event"] = payload.Action
-	ns := strings.Split(payload.Request.Host, ".")
-	event.Variables["namespace"] = ns[0]
-	event.Variables["name"] = payload.Target.Repository
-	event.Variables["tag"] = payload.Target.Tag
-	event.Variables["type"] = "registry"
+	event.Variables["action"] = action.action
+	event.Variables["namespace"] = registry
+	event.Variables["name"] = name
+	event.Variables["tag"] = tag
+	if region != "" {
+		event.Variables["region"] = region
+	}
+	event.Variables["digest"] = payload.Target.Digest
+	event.Variables["media_type"] = payload.Target.MediaType
+	event.Variables["size"] = fmt.Sprint(payload.Target.Size)
+	event.Variables["type"] = action.eventType
 	event.Variables["provider"] = "azure"
 	event.Variables["pushed_at"] = payload.Timestamp
 
-	// get secret from URL query
-	event.Secret = c.Query("secret")
-
-	log.Debug("Event url " + eventURI)
+	return []*hermes.NormalizedEvent{event}, nil
+}
 
-	// invoke trigger
-	err = d.hermesSvc.TriggerEvent(eventURI, event)
-	if err != nil {
-		log.WithError(err).Error("Failed to trigger event pipelines")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+// parseLoginServer get registry name and replica region (if any) from ACR login server host;
+// login server is <registry>.azurecr.io (or sovereign cloud domain) and geo-replicated registry
+// may report regional <registry>.<region>.data.azurecr.io host
+func parseLoginServer(host string) (registry string, region string, err error) {
+	if h, _, e := net.SplitHostPort(host); e == nil {
+		host = h
 	}
-
-	c.Status(http.StatusOK)
+	labels := strings.Split(strings.ToLower(host), ".")
+	if labels[0] == "" {
+		return "", "", fmt.Errorf("invalid azure login server: '%s'", host)
+	}
+	registry = labels[0]
+	// regional label is located between registry name and azurecr domain
+	for i, l := range labels {
+		if l == "azurecr" && i > 1 {
+			region = labels[1]
+			break
+		}
+	}
+	return registry, region, nil
 }
@@ -3,12 +3,17 @@ package azure
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -36,7 +41,6 @@ func TestContextBindWithQuery(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	payload.Target.Name = "repo"
 	data, _ := json.Marshal(payload)
 	c.Request, err = http.NewRequest("POST", "/azure?secret=SECRET&account=cb1e73c5215b", bytes.NewBufferString(string(data)))
 	if err != nil {
@@ -50,22 +54,130 @@ func TestContextBindWithQuery(t *testing.T) {
 		Original: string(data),
 		Secret:   "SECRET",
 		Variables: map[string]string{
-			"event":     "push",
-			"namespace": "host",
-			"name":      "namespace/repo",
-			"tag":       "latest",
-			"provider":  "azure",
-			"type":      "registry",
-			"pushed_at": "2018-11-05T18:24:27.609016022Z",
+			"event":         "push",
+			"action":        "push",
+			"namespace":     "host",
+			"name":          "namespace/repo",
+			"tag":           "latest",
+			"digest":        "",
+			"media_type":    "",
+			"size":          "0",
+			"provider":      "azure",
+			"type":          "registry",
+			"artifact_kind": "image",
+			"pushed_at":     "2018-11-05T18:24:27.609016022Z",
 		},
 	}
 	hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
 
 	// bind dockerhub to hermes API endpoint
-	azure := NewAzure(hermesMock)
-	router.POST("/azure", azure.HandleWebhook)
+	router.POST("/azure", provider.NewHandler(NewAzure("registry"), hermesMock))
 	router.HandleContext(c)
 
 	// assert expectations
 	hermesMock.AssertExpectations(t)
 }
+
+var update = flag.Bool("update", false, "update golden files")
+
+// golden event: expected event URI and variables
+type goldenEvent struct {
+	URI       string            `json:"uri"`
+	Variables map[string]string `json:"variables"`
+}
+
+// recording Hermes service
+type hermesRecorder struct {
+	events []goldenEvent
+}
+
+func (r *hermesRecorder) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	r.events = append(r.events, goldenEvent{URI: eventURI, Variables: event.Variables})
+	return nil
+}
+
+// TestGoldenPayloads every ACR payload shape in testdata/<name>.json produces events in testdata/<name>.golden
+func TestGoldenPayloads(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", "/azure?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorder := &hermesRecorder{events: []goldenEvent{}}
+			router.POST("/azure", provider.NewHandler(NewAzure("registry"), recorder))
+			router.HandleContext(c)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			actual, err := json.MarshalIndent(recorder.events, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err = ioutil.WriteFile(golden, append(actual, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestParseLoginServer(t *testing.T) {
+	tests := []struct {
+		host     string
+		registry string
+		region   string
+		wantErr  bool
+	}{
+		{"myregistry.azurecr.io", "myregistry", "", false},
+		{"MyRegistry.azurecr.io:443", "myregistry", "", false},
+		{"myregistry.westeurope.data.azurecr.io", "myregistry", "westeurope", false},
+		{"myregistry.azurecr.cn", "myregistry", "", false},
+		{"registry.example.com", "registry", "", false},
+		{"", "", "", true},
+		{".azurecr.io", "", "", true},
+	}
+	for _, tt := range tests {
+		registry, region, err := parseLoginServer(tt.host)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLoginServer(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			continue
+		}
+		assert.Equal(t, tt.registry, registry, tt.host)
+		assert.Equal(t, tt.region, region, tt.host)
+	}
+}
+
+func TestMissingHost(t *testing.T) {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+	var err error
+	c.Request, err = http.NewRequest("POST", "/azure?secret=SECRET", bytes.NewBufferString(`{"action":"push","target":{"repository":"repo","tag":"v1"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hermesMock := new(HermesMock)
+	router.POST("/azure", provider.NewHandler(NewAzure("registry"), hermesMock))
+	router.HandleContext(c)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+}
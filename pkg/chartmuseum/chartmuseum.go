@@ -0,0 +1,129 @@
+package chartmuseum
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ChartMuseum ChartMuseum helm repository provider
+//
+// ChartMuseum has no webhooks; an event relay (watching chart storage or index) posts uploaded
+// chart version metadata, in the same format as a helm repository index entry.
+type ChartMuseum struct {
+}
+
+type webhookPayload struct {
+	// Repo ChartMuseum repository (multitenant server path, "default" otherwise)
+	Repo        string   `json:"repo"`
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	AppVersion  string   `json:"appVersion,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Digest      string   `json:"digest,omitempty"`
+	Created     string   `json:"created,omitempty"`
+	URLs        []string `json:"urls,omitempty"`
+}
+
+func init() {
+	provider.Register(NewChartMuseum())
+}
+
+// NewChartMuseum new chartmuseum provider
+func NewChartMuseum() *ChartMuseum {
+	return &ChartMuseum{}
+}
+
+// Name provider name
+func (m *ChartMuseum) Name() string {
+	return "chartmuseum"
+}
+
+// EventType provider event type
+func (m *ChartMuseum) EventType() string {
+	return "helm"
+}
+
+// EventURI construct ChartMuseum event URI
+func (m *ChartMuseum) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "helm",
+		Provider:  "chartmuseum",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (m *ChartMuseum) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		Actions: []string{"push"},
+	}
+}
+
+// Describe ChartMuseum event info
+func (m *ChartMuseum) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "ChartMuseum",
+		SettingsLink: "https://chartmuseum.com/docs/",
+		Help:         "ChartMuseum events fire when a helm chart version is uploaded to your chart repository. ChartMuseum has no webhooks: configure your ChartMuseum event relay to post uploaded chart versions to the webhook endpoint.",
+	}
+}
+
+// ParsePayload parse ChartMuseum event relay payload
+func (m *ChartMuseum) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	payload := webhookPayload{}
+	if err := c.BindJSON(&payload); err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+	if payload.Name == "" || payload.Version == "" {
+		return nil, fmt.Errorf("missing chart name or version in ChartMuseum event")
+	}
+	if payload.Repo == "" {
+		payload.Repo = "default"
+	}
+	log.WithFields(log.Fields{
+		"repo":    payload.Repo,
+		"chart":   payload.Name,
+		"version": payload.Version,
+	}).Debug("Got ChartMuseum event")
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		log.WithError(err).Error("Failed to covert webhook payload structure to JSON")
+		return nil, err
+	}
+
+	event := hermes.NewNormalizedEvent()
+	// keep original JSON
+	event.Original = string(payloadJSON)
+
+	// get chart upload details
+	event.Variables["namespace"] = payload.Repo
+	event.Variables["name"] = payload.Name
+	event.Variables["tag"] = payload.Version
+	event.Variables["version"] = payload.Version
+	if payload.AppVersion != "" {
+		event.Variables["app_version"] = payload.AppVersion
+	}
+	if payload.Digest != "" {
+		event.Variables["digest"] = payload.Digest
+	}
+	if len(payload.URLs) > 0 {
+		event.Variables["url"] = payload.URLs[0]
+	}
+	event.Variables["provider"] = "chartmuseum"
+	event.Variables["type"] = "helm"
+	event.Variables["pushed_at"] = payload.Created
+
+	return []*hermes.NormalizedEvent{event}, nil
+}
@@ -0,0 +1,95 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+
+	file, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload webhookPayload
+	err = json.Unmarshal(file, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(payload)
+	c.Request, err = http.NewRequest("POST", "/helm/chartmuseum?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup mock
+	hermesMock := new(HermesMock)
+	eventURI := "helm:chartmuseum:stable:backend:push:cb1e73c5215b"
+	event := hermes.NormalizedEvent{
+		Original: string(data),
+		Secret:   "SECRET",
+		Variables: map[string]string{
+			"namespace":     "stable",
+			"name":          "backend",
+			"tag":           "0.3.0",
+			"version":       "0.3.0",
+			"app_version":   "1.4.2",
+			"digest":        "4f3a8f2b0c1d9e7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a",
+			"url":           "charts/backend-0.3.0.tgz",
+			"provider":      "chartmuseum",
+			"type":          "helm",
+			"artifact_kind": "helm-chart",
+			"pushed_at":     "2021-06-01T12:34:56.789Z",
+		},
+	}
+	hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
+
+	// bind chartmuseum to hermes API endpoint
+	router.POST("/helm/chartmuseum", provider.NewHandler(NewChartMuseum(), hermesMock))
+	router.HandleContext(c)
+
+	// assert expectations
+	hermesMock.AssertExpectations(t)
+}
+
+func TestMissingVersion(t *testing.T) {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+
+	var err error
+	c.Request, err = http.NewRequest("POST", "/helm/chartmuseum?secret=SECRET", bytes.NewBufferString(`{"repo":"stable","name":"backend"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hermesMock := new(HermesMock)
+	router.POST("/helm/chartmuseum", provider.NewHandler(NewChartMuseum(), hermesMock))
+	router.HandleContext(c)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", rr.Code, http.StatusBadRequest)
+	}
+	hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+}
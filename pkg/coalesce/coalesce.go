@@ -0,0 +1,137 @@
+package coalesce
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxWindow longest coalescing window
+const MaxWindow = time.Hour
+
+type (
+	// Coalescer buffers events with the same event URI (namespace/name) for coalescing window, started by
+	// the first event, and triggers a single event with all tags and the latest event variables
+	// (digest, pushed_at, ...) after window closes
+	Coalescer struct {
+		mu      sync.Mutex
+		svc     hermes.Service
+		batches map[string]*batch
+		// forget dedup keys of events, that failed to trigger
+		forget func(key string)
+	}
+
+	// events buffered for event URI
+	batch struct {
+		event *hermes.NormalizedEvent
+		tags  []string
+		count int
+		keys  []string
+		timer *time.Timer
+	}
+)
+
+// New create coalescer, triggering coalesced events with Hermes service; forget (optional) is called with
+// dedup keys of buffered events, when coalesced event fails to trigger
+func New(svc hermes.Service, forget func(key string)) *Coalescer {
+	return &Coalescer{svc: svc, batches: make(map[string]*batch), forget: forget}
+}
+
+// Add buffer event with its dedup key (optional); first event for event URI opens coalescing window
+func (c *Coalescer) Add(eventURI string, event *hermes.NormalizedEvent, key string, window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.batches[eventURI]
+	if !ok {
+		b = &batch{}
+		c.batches[eventURI] = b
+		b.timer = time.AfterFunc(window, func() { c.emit(eventURI) })
+		log.WithFields(log.Fields{
+			"event-uri": eventURI,
+			"window":    window,
+		}).Debug("Open coalescing window")
+	}
+	b.add(event)
+	if key != "" {
+		b.keys = append(b.keys, key)
+	}
+}
+
+// Flush trigger all buffered events now; call it on shutdown, buffered events are lost otherwise
+func (c *Coalescer) Flush() {
+	c.mu.Lock()
+	uris := make([]string, 0, len(c.batches))
+	for uri, b := range c.batches {
+		b.timer.Stop()
+		uris = append(uris, uri)
+	}
+	c.mu.Unlock()
+	for _, uri := range uris {
+		c.emit(uri)
+	}
+}
+
+// Pending number of open coalescing windows
+func (c *Coalescer) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.batches)
+}
+
+// emit trigger coalesced event and close coalescing window
+func (c *Coalescer) emit(eventURI string) {
+	c.mu.Lock()
+	b, ok := c.batches[eventURI]
+	delete(c.batches, eventURI)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	fields := log.Fields{
+		"event-uri": eventURI,
+		"events":    b.count,
+		"tags":      b.event.Variables["tags"],
+	}
+	log.WithFields(fields).Debug("Triggering coalesced event")
+	if err := c.svc.TriggerEvent(eventURI, b.event); err != nil {
+		log.WithError(err).WithFields(fields).Error("Failed to trigger coalesced event pipelines")
+		// webhook was acknowledged on buffering, so registry will not retry and event is lost, unless
+		// outbox or dead letter store catches it; forget keys, so manual redelivery is not suppressed
+		if c.forget != nil {
+			for _, key := range b.keys {
+				c.forget(key)
+			}
+		}
+	}
+}
+
+// add merge event into batch: latest event variables win, tags are collected in push order
+func (b *batch) add(event *hermes.NormalizedEvent) {
+	b.count++
+	if tag := event.Variables["tag"]; tag != "" {
+		found := false
+		for _, t := range b.tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.tags = append(b.tags, tag)
+		}
+	}
+	if b.event == nil {
+		b.event = hermes.NewNormalizedEvent()
+	}
+	for k, v := range event.Variables {
+		b.event.Variables[k] = v
+	}
+	b.event.Original = event.Original
+	b.event.Secret = event.Secret
+	b.event.Variables["tags"] = strings.Join(b.tags, ",")
+	b.event.Variables["coalesced"] = strconv.Itoa(b.count)
+}
@@ -0,0 +1,121 @@
+package coalesce
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+)
+
+// recording Hermes service
+type hermesStub struct {
+	mu     sync.Mutex
+	err    error
+	uris   []string
+	events []*hermes.NormalizedEvent
+}
+
+func (h *hermesStub) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		return h.err
+	}
+	h.uris = append(h.uris, eventURI)
+	h.events = append(h.events, event)
+	return nil
+}
+
+func (h *hermesStub) triggered() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.events)
+}
+
+func newEvent(tag, digest string) *hermes.NormalizedEvent {
+	event := hermes.NewNormalizedEvent()
+	event.Secret = "SECRET"
+	event.Variables["namespace"] = "codefresh"
+	event.Variables["name"] = "fortune"
+	event.Variables["tag"] = tag
+	event.Variables["digest"] = digest
+	return event
+}
+
+func TestCoalesce(t *testing.T) {
+	svc := &hermesStub{}
+	c := New(svc, nil)
+	uri := "registry:dockerhub:codefresh:fortune:push"
+	c.Add(uri, newEvent("1.0", "sha256:a"), "", time.Hour)
+	c.Add(uri, newEvent("latest", "sha256:a"), "", time.Hour)
+	c.Add(uri, newEvent("1.0", "sha256:b"), "", time.Hour)
+	c.Add("registry:dockerhub:codefresh:cowsay:push", newEvent("2.0", "sha256:c"), "", time.Hour)
+	if svc.triggered() != 0 || c.Pending() != 2 {
+		t.Fatalf("triggered = %d, pending = %d; want 0, 2", svc.triggered(), c.Pending())
+	}
+
+	c.Flush()
+	if svc.triggered() != 2 || c.Pending() != 0 {
+		t.Fatalf("triggered = %d, pending = %d; want 2, 0", svc.triggered(), c.Pending())
+	}
+	for i, u := range svc.uris {
+		if u != uri {
+			continue
+		}
+		vars := svc.events[i].Variables
+		if vars["tags"] != "1.0,latest" || vars["tag"] != "1.0" || vars["digest"] != "sha256:b" || vars["coalesced"] != "3" {
+			t.Errorf("coalesced event variables = %v", vars)
+		}
+		if svc.events[i].Secret != "SECRET" {
+			t.Errorf("coalesced event secret = %v", svc.events[i].Secret)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	svc := &hermesStub{}
+	c := New(svc, nil)
+	uri := "registry:dockerhub:codefresh:fortune:push"
+	c.Add(uri, newEvent("1.0", "sha256:a"), "", 20*time.Millisecond)
+	c.Add(uri, newEvent("1.1", "sha256:b"), "", 20*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for svc.triggered() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if svc.triggered() != 1 || c.Pending() != 0 {
+		t.Fatalf("triggered = %d, pending = %d; want 1, 0", svc.triggered(), c.Pending())
+	}
+
+	// next event opens new window
+	c.Add(uri, newEvent("1.2", "sha256:c"), "", time.Hour)
+	c.Flush()
+	if svc.triggered() != 2 || svc.events[1].Variables["tags"] != "1.2" || svc.events[1].Variables["coalesced"] != "1" {
+		t.Errorf("triggered = %d, events = %v", svc.triggered(), svc.events)
+	}
+}
+
+func TestForgetOnFailure(t *testing.T) {
+	svc := &hermesStub{err: errors.New("hermes is down")}
+	var forgotten []string
+	c := New(svc, func(key string) { forgotten = append(forgotten, key) })
+	uri := "registry:dockerhub:codefresh:fortune:push"
+	c.Add(uri, newEvent("1.0", "sha256:a"), uri+"#1.0@sha256:a", time.Hour)
+	c.Add(uri, newEvent("1.1", ""), "", time.Hour)
+	c.Add(uri, newEvent("1.2", "sha256:b"), uri+"#1.2@sha256:b", time.Hour)
+	c.Flush()
+	if len(forgotten) != 2 || forgotten[0] != uri+"#1.0@sha256:a" || forgotten[1] != uri+"#1.2@sha256:b" {
+		t.Errorf("forgotten = %v", forgotten)
+	}
+
+	// successful trigger keeps keys
+	svc.err = nil
+	forgotten = nil
+	c.Add(uri, newEvent("2.0", "sha256:c"), uri+"#2.0@sha256:c", time.Hour)
+	c.Flush()
+	if len(forgotten) != 0 {
+		t.Errorf("forgotten = %v", forgotten)
+	}
+}
@@ -0,0 +1,336 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Letter event, that failed delivery to Hermes service
+	Letter struct {
+		ID       uint64                  `json:"id"`
+		Time     time.Time               `json:"time"`
+		EventURI string                  `json:"uri"`
+		Event    *hermes.NormalizedEvent `json:"event"`
+		Error    string                  `json:"error"`
+		Attempts int                     `json:"attempts"`
+		// Replayed last successful replay time
+		Replayed *time.Time `json:"replayed,omitempty"`
+	}
+
+	// Filter dead letter filter; zero value matches all letters
+	Filter struct {
+		IDs   []uint64
+		Since time.Time
+		Until time.Time
+		// URI event URI glob pattern (path.Match syntax, but "*" matches '/' too: "registry:gitlab:*")
+		URI string
+		// Pending match not replayed letters only
+		Pending bool
+	}
+
+	// Result letter replay result
+	Result struct {
+		Letter *Letter
+		Err    error
+	}
+
+	// Store durable append-only dead letter store; server adds letters, replay command marks
+	// them replayed, appending to the same file
+	Store struct {
+		mu     sync.Mutex
+		path   string
+		file   *os.File
+		nextID uint64
+	}
+
+	// Recorder Hermes service, adding failed events to dead letter store
+	Recorder struct {
+		svc   hermes.Service
+		store *Store
+	}
+
+	// dead letter log record
+	record struct {
+		Op       string                  `json:"op"`
+		ID       uint64                  `json:"id"`
+		Time     time.Time               `json:"time"`
+		EventURI string                  `json:"uri,omitempty"`
+		Event    *hermes.NormalizedEvent `json:"event,omitempty"`
+		Error    string                  `json:"error,omitempty"`
+		Attempts int                     `json:"attempts,omitempty"`
+	}
+)
+
+// dead letter log record operations
+const (
+	opLetter   = "letter"
+	opReplayed = "replayed"
+)
+
+// log file name in dead letter directory
+const logFile = "deadletters.log"
+
+// Open open (or create) dead letter store in directory
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{path: filepath.Join(dir, logFile)}
+	letters, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range letters {
+		if l.ID > s.nextID {
+			s.nextID = l.ID
+		}
+	}
+	if s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add add failed event to store
+func (s *Store) Add(eventURI string, event *hermes.NormalizedEvent, cause error, attempts int) (*Letter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	r := &record{
+		Op:       opLetter,
+		ID:       s.nextID,
+		Time:     time.Now().UTC(),
+		EventURI: eventURI,
+		Event:    event,
+		Error:    cause.Error(),
+		Attempts: attempts,
+	}
+	if err := s.append(r); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"event-uri": eventURI,
+		"id":        r.ID,
+		"attempts":  attempts,
+	}).Warn("Event added to dead letter store")
+	return &Letter{ID: r.ID, Time: r.Time, EventURI: eventURI, Event: event, Error: r.Error, Attempts: attempts}, nil
+}
+
+// Redacted letter copy without event secret, safe to expose in API response
+func (l *Letter) Redacted() *Letter {
+	r := *l
+	if l.Event != nil {
+		event := *l.Event
+		event.Secret = ""
+		r.Event = &event
+	}
+	return &r
+}
+
+// MarkReplayed record successful letter replay
+func (s *Store) MarkReplayed(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.append(&record{Op: opReplayed, ID: id, Time: time.Now().UTC()})
+}
+
+// List letters matching filter, oldest first
+func (s *Store) List(filter *Filter) ([]*Letter, error) {
+	letters, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	matched := []*Letter{}
+	for _, l := range letters {
+		if filter.Match(l) {
+			matched = append(matched, l)
+		}
+	}
+	return matched, nil
+}
+
+// Replay send letters matching filter to Hermes service again; successfully replayed letters are
+// marked replayed
+func (s *Store) Replay(svc hermes.Service, filter *Filter) ([]Result, error) {
+	letters, err := s.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, l := range letters {
+		err = svc.TriggerEvent(l.EventURI, l.Event)
+		if err == nil {
+			if err = s.MarkReplayed(l.ID); err != nil {
+				log.WithError(err).WithField("id", l.ID).Error("Failed to mark dead letter replayed")
+			}
+		}
+		results = append(results, Result{Letter: l, Err: err})
+	}
+	return results, nil
+}
+
+// Close close dead letter log file
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// append write record to log file and sync it to disk; caller holds lock
+func (s *Store) append(r *record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err = s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// load read all letters from log file
+func (s *Store) load() ([]*Letter, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var letters []*Letter
+	byID := make(map[uint64]*Letter)
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// skip partial write of last record (crash or concurrent write)
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec record
+		if err = json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("bad dead letter record %s:%d: %v", s.path, line, err)
+		}
+		switch rec.Op {
+		case opLetter:
+			l := &Letter{ID: rec.ID, Time: rec.Time, EventURI: rec.EventURI, Event: rec.Event, Error: rec.Error, Attempts: rec.Attempts}
+			letters = append(letters, l)
+			byID[l.ID] = l
+		case opReplayed:
+			if l, ok := byID[rec.ID]; ok {
+				t := rec.Time
+				l.Replayed = &t
+			}
+		}
+	}
+	return letters, nil
+}
+
+// ParseFilter parse filter from comma separated ids, time range and event URI glob; time is either
+// RFC3339 time or duration before now ("24h")
+func ParseFilter(ids, since, until, uri string) (*Filter, error) {
+	filter := &Filter{URI: uri}
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad dead letter id '%s'", id)
+		}
+		filter.IDs = append(filter.IDs, n)
+	}
+	var err error
+	if filter.Since, err = parseTime(since); err != nil {
+		return nil, err
+	}
+	if filter.Until, err = parseTime(until); err != nil {
+		return nil, err
+	}
+	if _, err = matchURI(uri, ""); err != nil {
+		return nil, fmt.Errorf("bad event uri pattern '%s': %v", uri, err)
+	}
+	return filter, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time '%s': expected RFC3339 time or duration", value)
+	}
+	return t, nil
+}
+
+// Match check if letter matches filter
+func (f *Filter) Match(l *Letter) bool {
+	if len(f.IDs) > 0 {
+		found := false
+		for _, id := range f.IDs {
+			if id == l.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && l.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && l.Time.After(f.Until) {
+		return false
+	}
+	if f.URI != "" {
+		if ok, _ := matchURI(f.URI, l.EventURI); !ok {
+			return false
+		}
+	}
+	return !f.Pending || l.Replayed == nil
+}
+
+// match event URI against glob pattern; unlike path.Match, "*" spans '/', since event URI namespace and
+// name may be nested (ECR "123456789012/us-east-1", GitLab "group/sub/app")
+func matchURI(pattern, uri string) (bool, error) {
+	// path.Match "*" stops at '/' only: replace it with a character, that never appears in event URI
+	return path.Match(strings.Replace(pattern, "/", "\x00", -1), strings.Replace(uri, "/", "\x00", -1))
+}
+
+// NewRecorder wrap Hermes service: events, that failed delivery, are added to dead letter store
+func NewRecorder(svc hermes.Service, store *Store) *Recorder {
+	return &Recorder{svc: svc, store: store}
+}
+
+// TriggerEvent trigger event, adding it to dead letter store on failure; returns delivery error
+func (r *Recorder) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	err := r.svc.TriggerEvent(eventURI, event)
+	if err != nil {
+		if _, serr := r.store.Add(eventURI, event, err, hermes.Attempts(err)); serr != nil {
+			log.WithError(serr).WithField("event-uri", eventURI).Error("Failed to add event to dead letter store")
+		}
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+package deadletter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+)
+
+// recording Hermes service, failing while down
+type hermesStub struct {
+	down      bool
+	delivered []string
+}
+
+func (h *hermesStub) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	if h.down {
+		return &hermes.DeliveryError{Attempts: 4, Err: errors.New("hermes is down")}
+	}
+	h.delivered = append(h.delivered, eventURI)
+	return nil
+}
+
+func openStore(t *testing.T) (*Store, string) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func newEvent(tag string) *hermes.NormalizedEvent {
+	event := hermes.NewNormalizedEvent()
+	event.Secret = "SECRET"
+	event.Variables["tag"] = tag
+	return event
+}
+
+func TestRecorder(t *testing.T) {
+	s, dir := openStore(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	svc := &hermesStub{down: true}
+	r := NewRecorder(svc, s)
+
+	if err := r.TriggerEvent("registry:dockerhub:codefresh:fortune:push", newEvent("1.0")); err == nil {
+		t.Fatal("TriggerEvent() error = nil, want delivery error")
+	}
+	svc.down = false
+	if err := r.TriggerEvent("registry:dockerhub:codefresh:fortune:push", newEvent("1.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	letters, err := s.List(&Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("letters = %d, want 1", len(letters))
+	}
+	l := letters[0]
+	if l.ID != 1 || l.EventURI != "registry:dockerhub:codefresh:fortune:push" || l.Error != "hermes is down" ||
+		l.Attempts != 4 || l.Event.Variables["tag"] != "1.0" || l.Event.Secret != "SECRET" {
+		t.Errorf("letter = %+v", l)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s, dir := openStore(t)
+	defer os.RemoveAll(dir)
+	cause := errors.New("503 Service Unavailable")
+	s.Add("registry:dockerhub:codefresh:fortune:push", newEvent("1.0"), cause, 4)
+	s.Add("registry:quay:codefresh:fortune:push", newEvent("1.0"), cause, 4)
+	s.Add("registry:dockerhub:codefresh:cowsay:push", newEvent("2.0"), cause, 4)
+	s.Close()
+
+	// reopen: ids continue
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	l, err := s.Add("registry:dockerhub:acme:app:push", newEvent("3.0"), cause, 1)
+	if err != nil || l.ID != 4 {
+		t.Fatalf("Add() = %+v, %v; want id 4", l, err)
+	}
+
+	svc := &hermesStub{}
+	results, err := s.Replay(svc, &Filter{URI: "registry:dockerhub:codefresh:*", Pending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Letter.ID != 1 || results[1].Letter.ID != 3 {
+		t.Errorf("results = %+v", results)
+	}
+
+	// replayed letters are skipped
+	results, _ = s.Replay(svc, &Filter{Pending: true})
+	if len(results) != 2 || results[0].Letter.ID != 2 || results[1].Letter.ID != 4 {
+		t.Errorf("results = %+v", results)
+	}
+	if len(svc.delivered) != 4 {
+		t.Errorf("delivered = %v", svc.delivered)
+	}
+
+	// failed replay: letter stays pending
+	svc.down = true
+	results, _ = s.Replay(svc, &Filter{IDs: []uint64{2}})
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("results = %+v", results)
+	}
+	letters, _ := s.List(&Filter{})
+	for _, l := range letters {
+		if l.Replayed == nil {
+			t.Errorf("letter %d is not replayed", l.ID)
+		}
+	}
+}
+
+func TestIncompleteRecord(t *testing.T) {
+	s, dir := openStore(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+	s.Add("registry:dockerhub:codefresh:fortune:push", newEvent("1.0"), errors.New("down"), 1)
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"letter","id":2,"uri":"registry:dock`)
+	f.Close()
+
+	letters, err := s.List(&Filter{})
+	if err != nil || len(letters) != 1 {
+		t.Errorf("List() = %d letters, %v; want 1", len(letters), err)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("1, 3", "2018-05-01T10:00:00Z", "1h", "registry:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filter.IDs) != 2 || filter.IDs[0] != 1 || filter.IDs[1] != 3 {
+		t.Errorf("IDs = %v", filter.IDs)
+	}
+	if !filter.Since.Equal(time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Since = %v", filter.Since)
+	}
+	if d := time.Since(filter.Until); d < time.Hour || d > time.Hour+time.Minute {
+		t.Errorf("Until = %v", filter.Until)
+	}
+
+	for _, args := range [][]string{
+		{"one", "", "", ""},
+		{"", "yesterday", "", ""},
+		{"", "", "", "registry:["},
+	} {
+		if _, err := ParseFilter(args[0], args[1], args[2], args[3]); err == nil {
+			t.Errorf("ParseFilter(%q) error = nil", args)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Now()
+	replayed := now
+	l := &Letter{ID: 7, Time: now, EventURI: "registry:dockerhub:codefresh:fortune:push"}
+	tests := []struct {
+		name   string
+		filter Filter
+		letter *Letter
+		want   bool
+	}{
+		{"all", Filter{}, l, true},
+		{"id", Filter{IDs: []uint64{1, 7}}, l, true},
+		{"other id", Filter{IDs: []uint64{1}}, l, false},
+		{"since", Filter{Since: now.Add(-time.Minute)}, l, true},
+		{"too old", Filter{Since: now.Add(time.Minute)}, l, false},
+		{"too new", Filter{Until: now.Add(-time.Minute)}, l, false},
+		{"uri", Filter{URI: "registry:*:codefresh:*"}, l, true},
+		{"other uri", Filter{URI: "registry:quay:*"}, l, false},
+		{"nested namespace", Filter{URI: "registry:*"}, &Letter{ID: 9, Time: now, EventURI: "registry:ecr:123456789012/us-east-1:app:push"}, true},
+		{"nested name", Filter{URI: "registry:gitlab:*"}, &Letter{ID: 10, Time: now, EventURI: "registry:gitlab:registry.gitlab.com:group/sub/app:push"}, true},
+		{"nested name prefix", Filter{URI: "registry:gitlab:*:group/*:push"}, &Letter{ID: 10, Time: now, EventURI: "registry:gitlab:registry.gitlab.com:group/sub/app:push"}, true},
+		{"other nested name", Filter{URI: "registry:gitlab:*:other/*"}, &Letter{ID: 10, Time: now, EventURI: "registry:gitlab:registry.gitlab.com:group/sub/app:push"}, false},
+		{"pending", Filter{Pending: true}, l, true},
+		{"replayed", Filter{Pending: true}, &Letter{ID: 8, Time: now, Replayed: &replayed}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.letter); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	l := &Letter{ID: 1, EventURI: "registry:dockerhub:codefresh:fortune:push", Event: newEvent("1.0")}
+	r := l.Redacted()
+	if r.Event.Secret != "" || r.Event.Variables["tag"] != "1.0" || r.ID != 1 {
+		t.Errorf("Redacted() = %+v", r.Event)
+	}
+	if l.Event.Secret != "SECRET" {
+		t.Errorf("Redacted() changed letter secret: %v", l.Event.Secret)
+	}
+}
@@ -0,0 +1,76 @@
+package dedup
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// Cache TTL window of recently triggered event keys, suppressing duplicate events (webhook retries,
+// several notifications for one logical push)
+type Cache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	seen      map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// dedup metrics, exposed with expvar: duplicate events (hits) and unique events (misses)
+var (
+	metrics = expvar.NewMap("dedup")
+	hits    = new(expvar.Int)
+	misses  = new(expvar.Int)
+)
+
+func init() {
+	metrics.Set("hits", hits)
+	metrics.Set("misses", misses)
+}
+
+// New create dedup cache with TTL window
+func New(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, seen: make(map[string]time.Time), now: time.Now}
+}
+
+// Reserve record event key; false if key was recorded within TTL window (duplicate event)
+func (c *Cache) Reserve(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.sweep(now)
+	if t, ok := c.seen[key]; ok && now.Sub(t) < c.ttl {
+		hits.Add(1)
+		return false
+	}
+	c.seen[key] = now
+	misses.Add(1)
+	return true
+}
+
+// Forget remove event key (event failed to trigger), so event retry is not suppressed
+func (c *Cache) Forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.seen, key)
+}
+
+// Len number of recorded keys
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
+
+// sweep remove expired keys, once per TTL window; caller holds lock
+func (c *Cache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	for key, t := range c.seen {
+		if now.Sub(t) >= c.ttl {
+			delete(c.seen, key)
+		}
+	}
+	c.lastSweep = now
+}
@@ -0,0 +1,42 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	c := New(time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	before := hits.Value()
+
+	if !c.Reserve("registry:dockerhub:team:app:push#1.0@sha256:a") {
+		t.Error("Reserve() first event = false")
+	}
+	if c.Reserve("registry:dockerhub:team:app:push#1.0@sha256:a") {
+		t.Error("Reserve() duplicate event = true")
+	}
+	if !c.Reserve("registry:dockerhub:team:app:push#1.1@sha256:a") {
+		t.Error("Reserve() other event = false")
+	}
+	if got := hits.Value() - before; got != 1 {
+		t.Errorf("hits = %d, want 1", got)
+	}
+
+	// forgotten key is not duplicate
+	c.Forget("registry:dockerhub:team:app:push#1.1@sha256:a")
+	if !c.Reserve("registry:dockerhub:team:app:push#1.1@sha256:a") {
+		t.Error("Reserve() forgotten event = false")
+	}
+
+	// TTL window is over
+	now = now.Add(time.Minute)
+	if !c.Reserve("registry:dockerhub:team:app:push#1.0@sha256:a") {
+		t.Error("Reserve() expired event = false")
+	}
+	// expired keys are removed
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", c.Len())
+	}
+}
@@ -0,0 +1,203 @@
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// Distribution Docker Distribution (registry v2) notification endpoint provider
+type Distribution struct {
+	// secretHeader request header, configured in registry notifications endpoint, that holds the secret
+	secretHeader string
+}
+
+// Event Docker Distribution notification event
+type Event struct {
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Action    string `json:"action"`
+	Target    struct {
+		MediaType  string `json:"mediaType"`
+		Size       int64  `json:"size"`
+		Digest     string `json:"digest"`
+		Length     int64  `json:"length"`
+		Repository string `json:"repository"`
+		URL        string `json:"url"`
+		Tag        string `json:"tag"`
+	} `json:"target"`
+	Request struct {
+		ID        string `json:"id"`
+		Addr      string `json:"addr"`
+		Host      string `json:"host"`
+		Method    string `json:"method"`
+		UserAgent string `json:"useragent"`
+	} `json:"request"`
+	Actor struct {
+		Name string `json:"name"`
+	} `json:"actor"`
+	Source struct {
+		Addr       string `json:"addr"`
+		InstanceID string `json:"instanceID"`
+	} `json:"source"`
+}
+
+// Envelope Docker Distribution notification envelope
+type Envelope struct {
+	Events []Event `json:"events"`
+}
+
+// manifest media types: image manifests and manifest lists
+var manifestMediaTypes = map[string]bool{
+	"application/vnd.docker.distribution.manifest.v1+json":      true,
+	"application/vnd.docker.distribution.manifest.v1+prettyjws": true,
+	"application/vnd.docker.distribution.manifest.v2+json":      true,
+	"application/vnd.docker.distribution.manifest.list.v2+json": true,
+	"application/vnd.oci.image.manifest.v1+json":                true,
+	"application/vnd.oci.image.index.v1+json":                   true,
+}
+
+func init() {
+	provider.Register(NewDistribution())
+}
+
+// NewDistribution new distribution provider
+func NewDistribution() *Distribution {
+	return &Distribution{secretHeader: "Authorization"}
+}
+
+// Name provider name
+func (d *Distribution) Name() string {
+	return "distribution"
+}
+
+// EventType provider event type
+func (d *Distribution) EventType() string {
+	return "registry"
+}
+
+// Flags distribution command line flags
+func (d *Distribution) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "distribution-secret-header",
+			Usage:  "request header with secret, configured in registry notifications endpoint headers",
+			Value:  "Authorization",
+			EnvVar: "DISTRIBUTION_SECRET_HEADER",
+		},
+	}
+}
+
+// Configure set secret header
+func (d *Distribution) Configure(c *cli.Context) error {
+	d.secretHeader = c.String("distribution-secret-header")
+	return nil
+}
+
+// EventURI construct Distribution event URI
+func (d *Distribution) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "registry",
+		Provider:  "distribution",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// EventID Distribution notification id: same for notification retries
+func (d *Distribution) EventID(event *hermes.NormalizedEvent) string {
+	return event.Variables["event_id"]
+}
+
+// URIRule event URI validation rule: namespace is registry host
+func (d *Distribution) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		NestedName: true,
+		Actions:    []string{"push"},
+	}
+}
+
+// Describe Distribution event info
+func (d *Distribution) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "Docker Registry",
+		SettingsLink: "https://docs.docker.com/registry/configuration/#notifications",
+		Help: `Docker Registry notifications fire when an image manifest is pushed to your registry.
+Add the endpoint to registry 'notifications.endpoints' configuration; the trigger secret can be passed in a custom endpoint header instead of 'secret' query parameter.`,
+	}
+}
+
+// ParsePayload parse Docker Distribution notification envelope: one event per tagged manifest push
+func (d *Distribution) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	log.Debug("Got Docker Distribution notification")
+
+	envelope := Envelope{}
+	if err := c.BindJSON(&envelope); err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+
+	secret := provider.RequestSecret(c, d.secretHeader)
+
+	var events []*hermes.NormalizedEvent
+	for _, e := range envelope.Events {
+		if !IsManifestPush(&e) {
+			log.Debug(fmt.Sprintf("Skip event %s %s", e.Action, e.Target.MediaType))
+			continue
+		}
+		// multi-platform push: platform manifests are pushed by digest, before tagged index
+		if e.Target.Tag == "" {
+			log.Debug(fmt.Sprintf("Skip untagged manifest push %s@%s", e.Target.Repository, e.Target.Digest))
+			continue
+		}
+		eventJSON, err := json.Marshal(e)
+		if err != nil {
+			log.WithError(err).Error("Failed to covert notification event structure to JSON")
+			return nil, err
+		}
+
+		event := hermes.NewNormalizedEvent()
+		// keep original JSON
+		event.Original = string(eventJSON)
+		event.Secret = secret
+
+		// get image push details
+		event.Variables["namespace"] = e.Request.Host
+		event.Variables["name"] = e.Target.Repository
+		event.Variables["tag"] = e.Target.Tag
+		event.Variables["digest"] = e.Target.Digest
+		event.Variables["media_type"] = e.Target.MediaType
+		event.Variables["size"] = fmt.Sprint(e.Target.Size)
+		event.Variables["url"] = e.Target.URL
+		event.Variables["pusher"] = e.Actor.Name
+		event.Variables["event_id"] = e.ID
+		event.Variables["provider"] = "distribution"
+		event.Variables["event"] = "push"
+		event.Variables["type"] = "registry"
+		event.Variables["pushed_at"] = e.Timestamp
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// IsManifestPush check if notification event is a manifest push (not a layer blob push, pull or delete)
+func IsManifestPush(e *Event) bool {
+	if e.Action != "push" {
+		return false
+	}
+	if manifestMediaTypes[e.Target.MediaType] {
+		return true
+	}
+	return strings.Contains(e.Target.URL, "/manifests/")
+}
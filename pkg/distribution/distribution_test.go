@@ -0,0 +1,104 @@
+package distribution
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		value  string
+		secret string
+	}{
+		{"query secret", "/distribution?secret=SECRET&account=cb1e73c5215b", "Authorization", "Bearer IGNORED", "SECRET"},
+		{"authorization header", "/distribution?account=cb1e73c5215b", "Authorization", "Bearer SECRET", "SECRET"},
+		{"custom header", "/distribution?account=cb1e73c5215b", "X-Registry-Secret", "SECRET", "SECRET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+
+			file, err := ioutil.ReadFile("./test_payload.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var envelope Envelope
+			if err = json.Unmarshal(file, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			original, _ := json.Marshal(envelope.Events[0])
+			c.Request, err = http.NewRequest("POST", tt.url, bytes.NewBuffer(file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Request.Header.Set("Content-Type", "application/vnd.docker.distribution.events.v1+json")
+			c.Request.Header.Set(tt.header, tt.value)
+
+			// setup mock: only manifest push triggers event
+			hermesMock := new(HermesMock)
+			eventURI := "registry:distribution:registry.example.com%3A5000:library/test:push:cb1e73c5215b"
+			event := hermes.NormalizedEvent{
+				Original: string(original),
+				Secret:   tt.secret,
+				Variables: map[string]string{
+					"namespace":     "registry.example.com:5000",
+					"name":          "library/test",
+					"tag":           "latest",
+					"digest":        "sha256:0123456789abcdef0",
+					"media_type":    "application/vnd.docker.distribution.manifest.v2+json",
+					"size":          "1",
+					"url":           "http://registry.example.com:5000/v2/library/test/manifests/sha256:0123456789abcdef0",
+					"pusher":        "test-actor",
+					"event_id":      "asdf-asdf-asdf-asdf-0",
+					"provider":      "distribution",
+					"event":         "push",
+					"type":          "registry",
+					"artifact_kind": "image",
+					"pushed_at":     "2006-01-02T15:04:05Z",
+				},
+			}
+			hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
+
+			// bind distribution to hermes API endpoint
+			distribution := NewDistribution()
+			distribution.secretHeader = tt.header
+			router.POST("/distribution", provider.NewHandler(distribution, hermesMock))
+			router.HandleContext(c)
+
+			// assert expectations
+			hermesMock.AssertExpectations(t)
+			hermesMock.AssertNumberOfCalls(t, "TriggerEvent", 1)
+		})
+	}
+}
+
+func TestEventID(t *testing.T) {
+	event := hermes.NewNormalizedEvent()
+	event.Variables["event_id"] = "asdf-asdf-asdf-asdf-0"
+	if id := NewDistribution().EventID(event); id != "asdf-asdf-asdf-asdf-0" {
+		t.Errorf("EventID() = %v", id)
+	}
+}
@@ -3,17 +3,17 @@ package dockerhub
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"time"
 
+	"github.com/codefresh-io/nomios/pkg/eventuri"
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
 
-// DockerHub struct
+// DockerHub DockerHub webhook provider
 type DockerHub struct {
-	hermesSvc hermes.Service
 }
 
 type webhookPayload struct {
@@ -43,36 +43,71 @@ type webhookPayload struct {
 	} `json:"repository"`
 }
 
-// NewDockerHub new dockerhub handler
-func NewDockerHub(svc hermes.Service) *DockerHub {
-	return &DockerHub{svc}
+func init() {
+	provider.Register(NewDockerHub())
 }
 
-func constructEventURI(payload *webhookPayload, account string) string {
-	uri := fmt.Sprintf("registry:dockerhub:%s:%s:push", payload.Repository.Namespace, payload.Repository.Name)
-	if account != "" {
-		uri = fmt.Sprintf("%s:%s", uri, account)
+// NewDockerHub new dockerhub provider
+func NewDockerHub() *DockerHub {
+	return &DockerHub{}
+}
+
+// Name provider name
+func (d *DockerHub) Name() string {
+	return "dockerhub"
+}
+
+// EventType provider event type
+func (d *DockerHub) EventType() string {
+	return "registry"
+}
+
+// EventURI construct DockerHub event URI
+func (d *DockerHub) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "registry",
+		Provider:  "dockerhub",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (d *DockerHub) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		Actions: []string{"push"},
 	}
-	return uri
 }
 
-// HandleWebhook handle DockerHub webhook
-func (d *DockerHub) HandleWebhook(c *gin.Context) {
-	log.Debug("Got Docker Hub webhook event")
+// Describe DockerHub event info
+func (d *DockerHub) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "Docker Hub",
+		SettingsLink: fmt.Sprintf("https://hub.docker.com/r/%s/%s/~/settings/webhooks/", uri.Namespace, uri.Name),
+	}
+}
+
+// EventID DockerHub event identity: tag and push time (DockerHub payload has no digest)
+func (d *DockerHub) EventID(event *hermes.NormalizedEvent) string {
+	return event.Variables["tag"] + "@" + event.Variables["pushed_at"]
+}
+
+// ParsePayload parse DockerHub webhook payload
+func (d *DockerHub) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
 	payload := webhookPayload{}
 	if err := c.BindJSON(&payload); err != nil {
 		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 
 	event := hermes.NewNormalizedEvent()
-	eventURI := constructEventURI(&payload, c.Query("account"))
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		log.WithError(err).Error("Failed to covert webhook payload structure to JSON")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 	// keep original JSON
 	event.Original = string(payloadJSON)
@@ -88,16 +123,5 @@ func (d *DockerHub) HandleWebhook(c *gin.Context) {
 	event.Variables["url"] = payload.Repository.RepoURL
 	event.Variables["pushed_at"] = time.Unix(int64(payload.PushData.PushedAt), 0).Format(time.RFC3339)
 
-	// get secret from URL query
-	event.Secret = c.Query("secret")
-
-	// invoke trigger
-	err = d.hermesSvc.TriggerEvent(eventURI, event)
-	if err != nil {
-		log.WithError(err).Error("Failed to trigger event pipelines")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.Status(http.StatusOK)
+	return []*hermes.NormalizedEvent{event}, nil
 }
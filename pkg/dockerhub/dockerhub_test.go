@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/mock"
 )
@@ -51,24 +52,33 @@ func TestContextBindWithQuery(t *testing.T) {
 		Original: string(data),
 		Secret:   "SECRET",
 		Variables: map[string]string{
-			"namespace": "alexeiled",
-			"name":      "alpine-plus",
-			"tag":       "latest",
-			"pusher":    "alexeiled",
-			"provider":  "dockerhub",
-			"event":     "push",
-			"type":      "registry",
-			"url":       "https://hub.docker.com/r/alexeiled/alpine-plus",
-			"pushed_at": time.Unix(1512920349, 0).Format(time.RFC3339),
+			"namespace":     "alexeiled",
+			"name":          "alpine-plus",
+			"tag":           "latest",
+			"pusher":        "alexeiled",
+			"provider":      "dockerhub",
+			"event":         "push",
+			"type":          "registry",
+			"artifact_kind": "image",
+			"url":           "https://hub.docker.com/r/alexeiled/alpine-plus",
+			"pushed_at":     time.Unix(1512920349, 0).Format(time.RFC3339),
 		},
 	}
 	hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
 
 	// bind dockerhub to hermes API endpoint
-	dockerhub := NewDockerHub(hermesMock)
-	router.POST("/dockerhub", dockerhub.HandleWebhook)
+	router.POST("/dockerhub", provider.NewHandler(NewDockerHub(), hermesMock))
 	router.HandleContext(c)
 
 	// assert expectations
 	hermesMock.AssertExpectations(t)
 }
+
+func TestEventID(t *testing.T) {
+	event := hermes.NewNormalizedEvent()
+	event.Variables["tag"] = "latest"
+	event.Variables["pushed_at"] = "2018-04-29T11:15:27Z"
+	if id := NewDockerHub().EventID(event); id != "latest@2018-04-29T11:15:27Z" {
+		t.Errorf("EventID() = %v", id)
+	}
+}
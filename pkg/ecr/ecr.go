@@ -0,0 +1,196 @@
+package ecr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// ECR Amazon ECR provider for EventBridge and SNS delivered image action events
+type ECR struct {
+	client *http.Client
+	// allowSubscribeURL check SNS SubscribeURL before confirming subscription
+	allowSubscribeURL func(u *url.URL) bool
+}
+
+// SNS HTTP(S) notification
+type snsMessage struct {
+	Type         string `json:"Type"`
+	MessageID    string `json:"MessageId"`
+	TopicArn     string `json:"TopicArn"`
+	Message      string `json:"Message"`
+	Timestamp    string `json:"Timestamp"`
+	SubscribeURL string `json:"SubscribeURL"`
+}
+
+// EventBridge ECR Image Action event
+type webhookPayload struct {
+	ID         string `json:"id"`
+	DetailType string `json:"detail-type"`
+	Source     string `json:"source"`
+	Account    string `json:"account"`
+	Time       string `json:"time"`
+	Region     string `json:"region"`
+	Detail     struct {
+		Result         string `json:"result"`
+		RepositoryName string `json:"repository-name"`
+		ImageDigest    string `json:"image-digest"`
+		ActionType     string `json:"action-type"`
+		ImageTag       string `json:"image-tag"`
+	} `json:"detail"`
+}
+
+// SNS message types
+const (
+	snsNotification             = "Notification"
+	snsSubscriptionConfirmation = "SubscriptionConfirmation"
+	snsUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// SNS endpoint hosts: sns.{region}.amazonaws.com[.cn]
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+func init() {
+	provider.Register(NewECR())
+}
+
+// NewECR new ecr provider
+func NewECR() *ECR {
+	return &ECR{
+		client: &http.Client{Timeout: 10 * time.Second},
+		allowSubscribeURL: func(u *url.URL) bool {
+			return u.Scheme == "https" && snsHost.MatchString(u.Host)
+		},
+	}
+}
+
+// Name provider name
+func (e *ECR) Name() string {
+	return "ecr"
+}
+
+// EventType provider event type
+func (e *ECR) EventType() string {
+	return "registry"
+}
+
+// EventURI construct ECR event URI
+func (e *ECR) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "registry",
+		Provider:  "ecr",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule: namespace is {aws-account-id}/{region}
+func (e *ECR) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		NestedNamespace: true,
+		NestedName:      true,
+		Actions:         []string{"push"},
+	}
+}
+
+// Describe ECR event info
+func (e *ECR) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "Amazon ECR",
+		SettingsLink: "https://docs.aws.amazon.com/AmazonECR/latest/userguide/ecr-eventbridge.html",
+	}
+}
+
+// ParsePayload parse EventBridge ECR event, sent directly or wrapped in SNS notification
+func (e *ECR) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	log.Debug("Got ECR webhook event")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to read webhook payload")
+		return nil, err
+	}
+
+	// unwrap SNS notification
+	if msgType := c.Request.Header.Get("x-amz-sns-message-type"); msgType != "" {
+		msg := snsMessage{}
+		if err = json.Unmarshal(body, &msg); err != nil {
+			log.WithError(err).Error("Failed to parse SNS message")
+			return nil, err
+		}
+		switch msgType {
+		case snsSubscriptionConfirmation:
+			return nil, e.confirmSubscription(&msg)
+		case snsUnsubscribeConfirmation:
+			log.WithField("topic", msg.TopicArn).Info("SNS subscription removed")
+			return nil, nil
+		case snsNotification:
+			body = []byte(msg.Message)
+		default:
+			log.Debug(fmt.Sprintf("Skip SNS message %s", msgType))
+			return nil, nil
+		}
+	}
+
+	payload := webhookPayload{}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+
+	if payload.DetailType != "ECR Image Action" || payload.Detail.ActionType != "PUSH" {
+		log.Debug(fmt.Sprintf("Skip event %s %s", payload.DetailType, payload.Detail.ActionType))
+		return nil, nil
+	}
+
+	event := hermes.NewNormalizedEvent()
+	// keep original JSON
+	event.Original = string(body)
+
+	// get image push details
+	event.Variables["namespace"] = fmt.Sprintf("%s/%s", payload.Account, payload.Region)
+	event.Variables["name"] = payload.Detail.RepositoryName
+	event.Variables["tag"] = payload.Detail.ImageTag
+	event.Variables["digest"] = payload.Detail.ImageDigest
+	event.Variables["result"] = payload.Detail.Result
+	event.Variables["aws_account"] = payload.Account
+	event.Variables["region"] = payload.Region
+	event.Variables["provider"] = "ecr"
+	event.Variables["event"] = "push"
+	event.Variables["type"] = "registry"
+	event.Variables["pushed_at"] = payload.Time
+
+	return []*hermes.NormalizedEvent{event}, nil
+}
+
+// confirm SNS subscription by visiting SubscribeURL
+func (e *ECR) confirmSubscription(msg *snsMessage) error {
+	u, err := url.Parse(msg.SubscribeURL)
+	if err != nil || !e.allowSubscribeURL(u) {
+		return fmt.Errorf("unexpected SNS SubscribeURL: %s", msg.SubscribeURL)
+	}
+	log.WithField("topic", msg.TopicArn).Info("Confirming SNS subscription")
+	resp, err := e.client.Get(u.String())
+	if err != nil {
+		log.WithError(err).Error("Failed to confirm SNS subscription")
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: failed to confirm SNS subscription", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package ecr
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func expectedEvent(original string) *hermes.NormalizedEvent {
+	return &hermes.NormalizedEvent{
+		Original: original,
+		Secret:   "SECRET",
+		Variables: map[string]string{
+			"namespace":     "123456789012/us-west-2",
+			"name":          "team/my-repository-name",
+			"tag":           "latest",
+			"digest":        "sha256:7f5b2640fe6fb4f46592dfd3410c4a79dac4f89e4782432e0378abcd1234",
+			"result":        "SUCCESS",
+			"aws_account":   "123456789012",
+			"region":        "us-west-2",
+			"provider":      "ecr",
+			"event":         "push",
+			"type":          "registry",
+			"artifact_kind": "image",
+			"pushed_at":     "2019-11-16T01:54:34Z",
+		},
+	}
+}
+
+const eventURI = "registry:ecr:123456789012/us-west-2:team/my-repository-name:push:cb1e73c5215b"
+
+func serve(t *testing.T, ecr *ECR, hermesMock *HermesMock, body []byte, header map[string]string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+	var err error
+	c.Request, err = http.NewRequest("POST", "/ecr?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		c.Request.Header.Set(k, v)
+	}
+	router.POST("/ecr", provider.NewHandler(ecr, hermesMock))
+	router.HandleContext(c)
+	return rr
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	data, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup mock
+	hermesMock := new(HermesMock)
+	hermesMock.On("TriggerEvent", eventURI, expectedEvent(string(data))).Return(nil)
+
+	serve(t, NewECR(), hermesMock, data, nil)
+
+	// assert expectations
+	hermesMock.AssertExpectations(t)
+}
+
+func TestSNSNotification(t *testing.T) {
+	data, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(snsMessage{
+		Type:      "Notification",
+		MessageID: "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		TopicArn:  "arn:aws:sns:us-west-2:123456789012:ecr-push",
+		Message:   string(data),
+		Timestamp: "2019-11-16T01:54:35.000Z",
+	})
+
+	hermesMock := new(HermesMock)
+	hermesMock.On("TriggerEvent", eventURI, expectedEvent(string(data))).Return(nil)
+
+	serve(t, NewECR(), hermesMock, body, map[string]string{"x-amz-sns-message-type": "Notification"})
+
+	hermesMock.AssertExpectations(t)
+}
+
+func TestSNSSubscriptionConfirmation(t *testing.T) {
+	confirmed := false
+	sns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		confirmed = r.URL.Query().Get("Token") == "TOKEN"
+	}))
+	defer sns.Close()
+
+	tests := []struct {
+		name  string
+		allow bool
+		want  int
+	}{
+		{"confirm subscription", true, http.StatusOK},
+		{"reject unexpected SubscribeURL", false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			confirmed = false
+			body, _ := json.Marshal(snsMessage{
+				Type:         "SubscriptionConfirmation",
+				TopicArn:     "arn:aws:sns:us-west-2:123456789012:ecr-push",
+				SubscribeURL: sns.URL + "/?Action=ConfirmSubscription&Token=TOKEN",
+			})
+			ecr := NewECR()
+			ecr.allowSubscribeURL = func(u *url.URL) bool { return tt.allow }
+
+			hermesMock := new(HermesMock)
+			rr := serve(t, ecr, hermesMock, body, map[string]string{"x-amz-sns-message-type": "SubscriptionConfirmation"})
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if confirmed != tt.allow {
+				t.Errorf("confirmed = %v, want %v", confirmed, tt.allow)
+			}
+			hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSkipDelete(t *testing.T) {
+	payload := webhookPayload{DetailType: "ECR Image Action"}
+	payload.Detail.ActionType = "DELETE"
+	body, _ := json.Marshal(payload)
+
+	hermesMock := new(HermesMock)
+	rr := serve(t, NewECR(), hermesMock, body, nil)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status = %v, want %v", rr.Code, http.StatusOK)
+	}
+	hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+}
+
+func TestAllowSubscribeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://sns.us-west-2.amazonaws.com/?Action=ConfirmSubscription", true},
+		{"https://sns.cn-north-1.amazonaws.com.cn/?Action=ConfirmSubscription", true},
+		{"http://sns.us-west-2.amazonaws.com/?Action=ConfirmSubscription", false},
+		{"https://sns.us-west-2.amazonaws.com.evil.io/", false},
+		{"https://169.254.169.254/latest/meta-data/", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := NewECR().allowSubscribeURL(u); got != tt.want {
+			t.Errorf("allowSubscribeURL(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
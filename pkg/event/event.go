@@ -3,9 +3,10 @@ package event
 import (
 	"fmt"
 	"net/url"
-	"regexp"
 	"strings"
 
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -23,65 +24,33 @@ type (
 	}
 )
 
-const validURI = `^(registry|helm):(dockerhub|quay|jfrog|azure):[a-z0-9_-]+:[\/a-z0-9_-]+:push(:[[:xdigit:]]{12})$`
-
-// compiled validator regexp
-var validator, _ = regexp.Compile(validURI)
-
 // GetEventInfo get extended info from uri
 func GetEventInfo(publicDNS string, uri string, secret string) (*Info, error) {
-	log.WithFields(log.Fields{
-		"event-uri": uri,
-		"validator": validURI,
-	}).Debug("get trigger-event info")
-	if !validator.MatchString(uri) {
-		log.Error("failed to match event URI")
-		return nil, fmt.Errorf("unexpected event uri: %s", uri)
-	}
-	// split uri
-	s := strings.Split(uri, ":")
-
-	triggerType := s[0]
-
-	kind := s[1]
-	// dockerhub repository 1st
-	repo := s[2]
-	// dockerhub image 2nd
-	image := s[3]
-	// get account hash (may not exist)
-	var account string
-	if len(s) == 6 {
-		account = s[5]
+	log.WithField("event-uri", uri).Debug("get trigger-event info")
+	eventURI, err := eventuri.Parse(uri)
+	if err != nil {
+		log.WithError(err).Error("failed to parse event URI")
+		return nil, err
 	}
-
-	//TODO: refactor it, move to different classes , dockerhub_info.go and quay_info.go and imepelement different methods
-	var humanReadableType string
-	var settingsLink string
-
-	if triggerType == "registry" {
-		if kind == "quay" {
-			humanReadableType = "Quay"
-			settingsLink = fmt.Sprintf("https://quay.io/repository/%s/%s?tab=settings", repo, image)
-		} else if kind == "jfrog" {
-			humanReadableType = "JFrog Artifactory"
-			settingsLink = "https://codefresh.io/docs/docs/configure-ci-cd-pipeline/triggers/jfrog-triggers/"
-		} else if kind == "azure" {
-			humanReadableType = "Azure"
-			settingsLink = "https://codefresh.io/docs/docs/configure-ci-cd-pipeline/triggers/azure-triggers/"
-		} else {
-			humanReadableType = "Docker Hub"
-			settingsLink = fmt.Sprintf("https://hub.docker.com/r/%s/%s/~/settings/webhooks/", repo, image)
-		}
-	} else {
-		if kind == "jfrog" {
-			humanReadableType = "JFrog Artifactory"
-			settingsLink = "https://codefresh.io/docs/docs/configure-ci-cd-pipeline/triggers/jfrog-triggers/"
-		}
+	triggerType := eventURI.Type
+	kind := eventURI.Provider
+	repo := eventURI.Namespace
+	image := eventURI.Name
+	account := eventURI.Account
+
+	// get provider by event type and name
+	p, ok := provider.Lookup(triggerType, kind)
+	if !ok {
+		log.WithField("provider", kind).Error("unknown event provider")
+		return nil, fmt.Errorf("unknown event provider: %s:%s", triggerType, kind)
 	}
+	desc := p.Describe(eventURI)
+	humanReadableType := desc.Title
+	settingsLink := desc.SettingsLink
 
 	// format info
 	info := new(Info)
-	info.Description = fmt.Sprintf("%s %s/%s push event", humanReadableType, repo, image)
+	info.Description = fmt.Sprintf("%s %s/%s %s event", humanReadableType, repo, image, eventURI.Action)
 	// handle endpoint url
 	u, err := url.Parse(publicDNS)
 	if err != nil {
@@ -92,22 +61,25 @@ func GetEventInfo(publicDNS string, uri string, secret string) (*Info, error) {
 		if account != "" {
 			q.Set("account", account)
 		}
-
-		if triggerType == "registry" {
-			u.Path = "nomios/" + kind + u.Path
-		} else {
-			u.Path = "nomios/" + triggerType + "/" + kind + u.Path
+		for k, v := range desc.Params {
+			q[k] = v
 		}
 
+		u.Path = strings.TrimPrefix(provider.Path(p), "/") + u.Path
+
 		u.RawQuery = q.Encode()
 		info.Endpoint = u.String()
 	}
 	info.Status = "active"
-	info.Help = fmt.Sprintf(`%s webhooks fire when an image is built in, pushed or a new tag is added to, your repository.
+	help := desc.Help
+	if help == "" {
+		help = fmt.Sprintf("%s webhooks fire when an image is built in, pushed or a new tag is added to, your repository.", humanReadableType)
+	}
+	info.Help = fmt.Sprintf(`%s
 
 Configure %s on %s
 
-Add following Codefresh %s webhook endpoint %s`, humanReadableType, humanReadableType, settingsLink, humanReadableType, info.Endpoint)
+Add following Codefresh %s webhook endpoint %s`, help, humanReadableType, settingsLink, humanReadableType, info.Endpoint)
 
 	// return info
 	return info, nil
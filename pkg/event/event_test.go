@@ -1,7 +1,12 @@
 package event
 
 import (
+	"strings"
 	"testing"
+
+	_ "github.com/codefresh-io/nomios/pkg/dockerhub"
+	_ "github.com/codefresh-io/nomios/pkg/harbor"
+	_ "github.com/codefresh-io/nomios/pkg/quay"
 )
 
 func TestGetEventInfo(t *testing.T) {
@@ -72,6 +77,16 @@ func TestGetEventInfo(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "test unknown provider",
+			args: args{
+				dns:    "https://public-ip",
+				uri:    "registry:unknown:codefresh:fortune:push:cb1e73c5215b",
+				secret: "123456789",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "test bad event uri",
 			args: args{
@@ -98,3 +113,33 @@ func TestGetEventInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestGetEventInfoHarbor(t *testing.T) {
+	got, err := GetEventInfo("https://public-ip", "registry:harbor:library:team/app:push:cb1e73c5215b", "123456789")
+	if err != nil {
+		t.Fatalf("GetEventInfo() error = %v", err)
+	}
+	if got.Description != "Harbor library/team/app push event" {
+		t.Errorf("GetEventInfo() description = %v", got.Description)
+	}
+	if got.Endpoint != "https://public-ip/nomios/harbor?account=cb1e73c5215b&secret=123456789" {
+		t.Errorf("GetEventInfo() endpoint = %v", got.Endpoint)
+	}
+	if !strings.HasPrefix(got.Help, "Harbor webhooks fire when an artifact is pushed to, deleted from or scanned") ||
+		!strings.Contains(got.Help, "https://goharbor.io/docs/") {
+		t.Errorf("GetEventInfo() help = %v", got.Help)
+	}
+}
+
+func TestGetEventInfoQuayBuild(t *testing.T) {
+	got, err := GetEventInfo("https://public-ip", "registry:quay:codefresh:fortune:build_failure:cb1e73c5215b", "123456789")
+	if err != nil {
+		t.Fatalf("GetEventInfo() error = %v", err)
+	}
+	if got.Description != "Quay codefresh/fortune build_failure event" {
+		t.Errorf("GetEventInfo() description = %v", got.Description)
+	}
+	if got.Endpoint != "https://public-ip/nomios/quay?account=cb1e73c5215b&event=build_failure&secret=123456789" {
+		t.Errorf("GetEventInfo() endpoint = %v", got.Endpoint)
+	}
+}
@@ -0,0 +1,215 @@
+package eventuri
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type (
+	// URI event URI: {type}:{provider}:{namespace}:{name}:{action}[:{account}]
+	URI struct {
+		// Type event type (registry, helm, artifact)
+		Type string
+		// Provider event provider (dockerhub, quay, ...)
+		Provider string
+		// Namespace unescaped namespace (repository owner, registry name, repo key, ...)
+		Namespace string
+		// Name unescaped name (image, chart, artifact path, ...)
+		Name string
+		// Action event action (push, ...)
+		Action string
+		// Account Codefresh account hash (optional)
+		Account string
+	}
+
+	// Rule event URI validation rule for specific provider
+	Rule struct {
+		// NestedNamespace namespace may be a '/' separated path
+		NestedNamespace bool
+		// NestedName name may be a '/' separated path
+		NestedName bool
+		// Actions allowed event actions
+		Actions []string
+	}
+)
+
+var (
+	validType     = regexp.MustCompile(`^[a-z]+$`)
+	validProvider = regexp.MustCompile(`^[a-z0-9]+$`)
+	validAction   = regexp.MustCompile(`^[a-z0-9_]+$`)
+	validAccount  = regexp.MustCompile(`^[[:xdigit:]]{12}$`)
+
+	mu    sync.RWMutex
+	rules = make(map[string]Rule)
+)
+
+func key(eventType, provider string) string {
+	return eventType + ":" + provider
+}
+
+// RegisterRule register validation rule for event type and provider
+func RegisterRule(eventType, provider string, rule Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules[key(eventType, provider)] = rule
+}
+
+// LookupRule get validation rule for event type and provider
+func LookupRule(eventType, provider string) (Rule, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	rule, ok := rules[key(eventType, provider)]
+	return rule, ok
+}
+
+// Parse parse and validate event URI string
+func Parse(s string) (*URI, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 5 && len(parts) != 6 {
+		return nil, fmt.Errorf("unexpected event uri: %s", s)
+	}
+	uri := &URI{
+		Type:     parts[0],
+		Provider: parts[1],
+		Action:   parts[4],
+	}
+	if len(parts) == 6 {
+		uri.Account = parts[5]
+	}
+	var err error
+	if uri.Namespace, err = Unescape(parts[2]); err != nil {
+		return nil, fmt.Errorf("bad namespace in event uri %s: %v", s, err)
+	}
+	if uri.Name, err = Unescape(parts[3]); err != nil {
+		return nil, fmt.Errorf("bad name in event uri %s: %v", s, err)
+	}
+	// escaped segments must be in canonical form
+	rule, _ := LookupRule(uri.Type, uri.Provider)
+	if Escape(uri.Namespace, rule.NestedNamespace) != parts[2] || Escape(uri.Name, rule.NestedName) != parts[3] {
+		return nil, fmt.Errorf("unexpected event uri: %s", s)
+	}
+	if err = uri.Validate(); err != nil {
+		return nil, err
+	}
+	return uri, nil
+}
+
+// Validate validate event URI against provider rule
+func (u *URI) Validate() error {
+	if !validType.MatchString(u.Type) {
+		return fmt.Errorf("bad event type: %q", u.Type)
+	}
+	if !validProvider.MatchString(u.Provider) {
+		return fmt.Errorf("bad event provider: %q", u.Provider)
+	}
+	rule, ok := LookupRule(u.Type, u.Provider)
+	if !ok {
+		return fmt.Errorf("unknown event provider: %s:%s", u.Type, u.Provider)
+	}
+	if err := validateSegment(u.Namespace, rule.NestedNamespace); err != nil {
+		return fmt.Errorf("bad event namespace %q: %v", u.Namespace, err)
+	}
+	if err := validateSegment(u.Name, rule.NestedName); err != nil {
+		return fmt.Errorf("bad event name %q: %v", u.Name, err)
+	}
+	if !validAction.MatchString(u.Action) || !contains(rule.Actions, u.Action) {
+		return fmt.Errorf("unsupported %s:%s event action: %q", u.Type, u.Provider, u.Action)
+	}
+	if u.Account != "" && !validAccount.MatchString(u.Account) {
+		return fmt.Errorf("bad account: %q", u.Account)
+	}
+	return nil
+}
+
+// String format event URI, escaping namespace and name
+func (u *URI) String() string {
+	rule, _ := LookupRule(u.Type, u.Provider)
+	parts := []string{
+		u.Type,
+		u.Provider,
+		Escape(u.Namespace, rule.NestedNamespace),
+		Escape(u.Name, rule.NestedName),
+		u.Action,
+	}
+	if u.Account != "" {
+		parts = append(parts, u.Account)
+	}
+	return strings.Join(parts, ":")
+}
+
+// Escape percent-encode URI segment; '/' is kept as is only for nested segments
+func Escape(s string, nested bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isSafe(c) || (nested && c == '/') {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// Unescape decode percent-encoded URI segment
+func Unescape(s string) (string, error) {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '%' {
+			buf.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			return "", fmt.Errorf("invalid escape sequence %q", s[i:])
+		}
+		buf.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+		i += 2
+	}
+	return buf.String(), nil
+}
+
+func validateSegment(s string, nested bool) error {
+	if s == "" {
+		return fmt.Errorf("empty value")
+	}
+	if !nested {
+		return nil
+	}
+	for _, p := range strings.Split(s, "/") {
+		if p == "" {
+			return fmt.Errorf("empty path element")
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func isSafe(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,127 @@
+package eventuri
+
+import (
+	"reflect"
+	"testing"
+)
+
+func init() {
+	RegisterRule("registry", "flat", Rule{Actions: []string{"push"}})
+	RegisterRule("registry", "nested", Rule{NestedNamespace: true, NestedName: true, Actions: []string{"push", "delete"}})
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		want    *URI
+		wantErr bool
+	}{
+		{
+			name: "with account",
+			uri:  "registry:flat:codefresh:fortune:push:cb1e73c5215b",
+			want: &URI{Type: "registry", Provider: "flat", Namespace: "codefresh", Name: "fortune", Action: "push", Account: "cb1e73c5215b"},
+		},
+		{
+			name: "without account",
+			uri:  "registry:flat:codefresh:fortune:push",
+			want: &URI{Type: "registry", Provider: "flat", Namespace: "codefresh", Name: "fortune", Action: "push"},
+		},
+		{
+			name: "escaped name",
+			uri:  "registry:flat:codefresh:team%2Fapp%3Av1:push",
+			want: &URI{Type: "registry", Provider: "flat", Namespace: "codefresh", Name: "team/app:v1", Action: "push"},
+		},
+		{
+			name: "nested name",
+			uri:  "registry:nested:group/sub:team/app:delete",
+			want: &URI{Type: "registry", Provider: "nested", Namespace: "group/sub", Name: "team/app", Action: "delete"},
+		},
+		{
+			name:    "unescaped slash in flat name",
+			uri:     "registry:flat:codefresh:team/app:push",
+			wantErr: true,
+		},
+		{
+			name:    "empty nested path element",
+			uri:     "registry:nested:group//sub:app:push",
+			wantErr: true,
+		},
+		{
+			name:    "missing segment",
+			uri:     "registry:flat:codefresh:push:cb1e73c5215b",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported action",
+			uri:     "registry:flat:codefresh:fortune:delete",
+			wantErr: true,
+		},
+		{
+			name:    "unknown provider",
+			uri:     "registry:unknown:codefresh:fortune:push",
+			wantErr: true,
+		},
+		{
+			name:    "bad account",
+			uri:     "registry:flat:codefresh:fortune:push:account",
+			wantErr: true,
+		},
+		{
+			name:    "bad escape",
+			uri:     "registry:flat:codefresh:fortune%2:push",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURI_String(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  URI
+		want string
+	}{
+		{
+			name: "with account",
+			uri:  URI{Type: "registry", Provider: "flat", Namespace: "codefresh", Name: "fortune", Action: "push", Account: "cb1e73c5215b"},
+			want: "registry:flat:codefresh:fortune:push:cb1e73c5215b",
+		},
+		{
+			name: "flat escaping",
+			uri:  URI{Type: "registry", Provider: "flat", Namespace: "codefresh", Name: "team/app:v1", Action: "push"},
+			want: "registry:flat:codefresh:team%2Fapp%3Av1:push",
+		},
+		{
+			name: "nested escaping",
+			uri:  URI{Type: "registry", Provider: "nested", Namespace: "group/sub", Name: "team/app:v1", Action: "push"},
+			want: "registry:nested:group/sub:team/app%3Av1:push",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.uri.String()
+			if got != tt.want {
+				t.Errorf("URI.String() = %v, want %v", got, tt.want)
+			}
+			parsed, err := Parse(got)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(*parsed, tt.uri) {
+				t.Errorf("Parse() = %v, want %v", *parsed, tt.uri)
+			}
+		})
+	}
+}
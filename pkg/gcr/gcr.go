@@ -0,0 +1,212 @@
+package gcr
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// GCR Google Container Registry and Artifact Registry Pub/Sub push provider
+type GCR struct {
+	// verifier Pub/Sub push JWT verifier; nil if authentication is disabled
+	verifier *TokenVerifier
+}
+
+// Pub/Sub push request envelope
+type pushEnvelope struct {
+	Message struct {
+		Attributes  map[string]string `json:"attributes"`
+		Data        string            `json:"data"`
+		MessageID   string            `json:"messageId"`
+		PublishTime string            `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// gcr topic message
+type webhookPayload struct {
+	Action string `json:"action"`
+	Digest string `json:"digest"`
+	Tag    string `json:"tag"`
+}
+
+// image reference: {host}/{project}/{image}[:{tag}][@{digest}]
+type imageRef struct {
+	Host    string
+	Project string
+	Image   string
+	Tag     string
+	Digest  string
+}
+
+func init() {
+	provider.Register(NewGCR())
+}
+
+// NewGCR new gcr provider
+func NewGCR() *GCR {
+	return &GCR{}
+}
+
+// Name provider name
+func (g *GCR) Name() string {
+	return "gcr"
+}
+
+// EventType provider event type
+func (g *GCR) EventType() string {
+	return "registry"
+}
+
+// Flags gcr command line flags
+func (g *GCR) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "gcr-audience",
+			Usage:  "expected audience of Pub/Sub push JWT token; authentication is disabled if empty",
+			EnvVar: "GCR_PUSH_AUDIENCE",
+		},
+		cli.StringFlag{
+			Name:   "gcr-service-account",
+			Usage:  "expected service account email of Pub/Sub push JWT token (optional)",
+			EnvVar: "GCR_PUSH_SERVICE_ACCOUNT",
+		},
+		cli.StringFlag{
+			Name:   "gcr-certs-url",
+			Usage:  "JWKS URL with Google public keys, used to verify Pub/Sub push JWT token",
+			Value:  GoogleCertsURL,
+			EnvVar: "GCR_PUSH_CERTS_URL",
+		},
+	}
+}
+
+// Configure configure Pub/Sub push authentication
+func (g *GCR) Configure(c *cli.Context) error {
+	if audience := c.String("gcr-audience"); audience != "" {
+		g.verifier = NewTokenVerifier(c.String("gcr-certs-url"), audience, c.String("gcr-service-account"))
+	}
+	return nil
+}
+
+// EventURI construct GCR event URI
+func (g *GCR) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "registry",
+		Provider:  "gcr",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (g *GCR) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		NestedName: true,
+		Actions:    []string{"push"},
+	}
+}
+
+// Describe GCR event info
+func (g *GCR) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "Google Container Registry",
+		SettingsLink: "https://cloud.google.com/artifact-registry/docs/configure-notifications",
+	}
+}
+
+// ParsePayload parse Pub/Sub push request with gcr topic message
+func (g *GCR) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	log.Debug("Got GCR Pub/Sub push event")
+
+	if g.verifier != nil {
+		if err := g.verifier.VerifyRequest(c.Request); err != nil {
+			return nil, &provider.AuthError{Reason: err.Error()}
+		}
+	}
+
+	envelope := pushEnvelope{}
+	if err := c.BindJSON(&envelope); err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+	if err != nil {
+		log.WithError(err).Error("Failed to decode Pub/Sub message data")
+		return nil, err
+	}
+	payload := webhookPayload{}
+	if err = json.Unmarshal(data, &payload); err != nil {
+		log.WithError(err).Error("Failed to parse Pub/Sub message data")
+		return nil, err
+	}
+
+	if payload.Action != "INSERT" {
+		log.Debug(fmt.Sprintf("Skip event %s", payload.Action))
+		return nil, nil
+	}
+
+	// tag reference is missing for untagged pushes
+	ref := payload.Tag
+	if ref == "" {
+		ref = payload.Digest
+	}
+	image, err := parseImageRef(ref)
+	if err != nil {
+		log.WithError(err).Error("Failed to parse image reference")
+		return nil, err
+	}
+	if payload.Digest != "" {
+		if digest, err := parseImageRef(payload.Digest); err == nil {
+			image.Digest = digest.Digest
+		}
+	}
+
+	event := hermes.NewNormalizedEvent()
+	// keep original JSON
+	event.Original = string(data)
+
+	// get image push details
+	event.Variables["namespace"] = image.Project
+	event.Variables["name"] = image.Image
+	event.Variables["tag"] = image.Tag
+	event.Variables["digest"] = image.Digest
+	event.Variables["host"] = image.Host
+	event.Variables["provider"] = "gcr"
+	event.Variables["event"] = "push"
+	event.Variables["type"] = "registry"
+	event.Variables["pushed_at"] = envelope.Message.PublishTime
+	event.Variables["message_id"] = envelope.Message.MessageID
+
+	return []*hermes.NormalizedEvent{event}, nil
+}
+
+func parseImageRef(ref string) (*imageRef, error) {
+	image := &imageRef{}
+	if i := strings.Index(ref, "@"); i != -1 {
+		image.Digest = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i != -1 && i > strings.LastIndex(ref, "/") {
+		image.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+	parts := strings.SplitN(ref, "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("unexpected image reference: %s", ref)
+	}
+	image.Host = parts[0]
+	image.Project = parts[1]
+	image.Image = parts[2]
+	return image, nil
+}
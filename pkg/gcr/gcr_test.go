@@ -0,0 +1,222 @@
+package gcr
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func expectedEvent() *hermes.NormalizedEvent {
+	return &hermes.NormalizedEvent{
+		Original: `{"action":"INSERT","digest":"us-east1-docker.pkg.dev/my-project/my-repo/hello-world@sha256:6ec128e26cd5b1cd5b3bdbf8f3e0d6e8b9ab4c6d9f6f3e1b5b0e5c0b6d6f3a1b","tag":"us-east1-docker.pkg.dev/my-project/my-repo/hello-world:1.1"}`,
+		Secret:   "SECRET",
+		Variables: map[string]string{
+			"namespace":     "my-project",
+			"name":          "my-repo/hello-world",
+			"tag":           "1.1",
+			"digest":        "sha256:6ec128e26cd5b1cd5b3bdbf8f3e0d6e8b9ab4c6d9f6f3e1b5b0e5c0b6d6f3a1b",
+			"host":          "us-east1-docker.pkg.dev",
+			"provider":      "gcr",
+			"event":         "push",
+			"type":          "registry",
+			"artifact_kind": "image",
+			"pushed_at":     "2021-02-26T19:13:55.749Z",
+			"message_id":    "2070443601311540",
+		},
+	}
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+
+	data, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Request, err = http.NewRequest("POST", "/gcr?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setup mock
+	hermesMock := new(HermesMock)
+	eventURI := "registry:gcr:my-project:my-repo/hello-world:push:cb1e73c5215b"
+	hermesMock.On("TriggerEvent", eventURI, expectedEvent()).Return(nil)
+
+	// bind gcr to hermes API endpoint
+	router.POST("/gcr", provider.NewHandler(NewGCR(), hermesMock))
+	router.HandleContext(c)
+
+	// assert expectations
+	hermesMock.AssertExpectations(t)
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestPushAuthentication(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// local JWKS stand-in for Google certs
+	certs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer certs.Close()
+
+	claims := func(aud string, exp time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":            "https://accounts.google.com",
+			"aud":            aud,
+			"email":          "pusher@my-project.iam.gserviceaccount.com",
+			"email_verified": true,
+			"iat":            time.Now().Unix(),
+			"exp":            exp.Unix(),
+		}
+	}
+	hour := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"valid token", signToken(t, key, "test-key", claims("https://nomios/gcr", hour)), http.StatusOK},
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong audience", signToken(t, key, "test-key", claims("https://other", hour)), http.StatusUnauthorized},
+		{"expired token", signToken(t, key, "test-key", claims("https://nomios/gcr", time.Now().Add(-time.Hour))), http.StatusUnauthorized},
+		{"wrong key", signToken(t, otherKey, "test-key", claims("https://nomios/gcr", hour)), http.StatusUnauthorized},
+		{"unknown key", signToken(t, key, "other-key", claims("https://nomios/gcr", hour)), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			data, err := ioutil.ReadFile("./test_payload.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Request, err = http.NewRequest("POST", "/gcr?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			hermesMock := new(HermesMock)
+			hermesMock.On("TriggerEvent", "registry:gcr:my-project:my-repo/hello-world:push:cb1e73c5215b", expectedEvent()).Return(nil)
+
+			gcr := NewGCR()
+			gcr.verifier = NewTokenVerifier(certs.URL, "https://nomios/gcr", "pusher@my-project.iam.gserviceaccount.com")
+			router.POST("/gcr", provider.NewHandler(gcr, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.want == http.StatusOK {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestUnknownKeyRefetch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches int32
+	certs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{}})
+	}))
+	defer certs.Close()
+
+	v := NewTokenVerifier(certs.URL, "https://nomios/gcr", "")
+	for _, kid := range []string{"random-1", "random-2", "random-3"} {
+		if err := v.Verify(signToken(t, key, kid, map[string]interface{}{})); err == nil {
+			t.Errorf("Verify(%s) error = nil", kid)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("keys fetched %d times, want 1", n)
+	}
+}
+
+func Test_parseImageRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    imageRef
+		wantErr bool
+	}{
+		{"gcr.io/my-project/hello-world:1.1", imageRef{Host: "gcr.io", Project: "my-project", Image: "hello-world", Tag: "1.1"}, false},
+		{"gcr.io/my-project/team/hello-world@sha256:abc", imageRef{Host: "gcr.io", Project: "my-project", Image: "team/hello-world", Digest: "sha256:abc"}, false},
+		{"localhost:5000/my-project/hello-world", imageRef{Host: "localhost:5000", Project: "my-project", Image: "hello-world"}, false},
+		{"gcr.io/hello-world:1.1", imageRef{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := parseImageRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseImageRef() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != nil && *got != tt.want {
+				t.Errorf("parseImageRef() = %v, want %v", *got, tt.want)
+			}
+		})
+	}
+}
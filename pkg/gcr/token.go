@@ -0,0 +1,210 @@
+package gcr
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoogleCertsURL Google OAuth2 public keys (JWKS), used to sign Pub/Sub push tokens
+const GoogleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// keys refresh interval
+const keysTTL = time.Hour
+
+// shortest interval between keys fetches, limits refetch on unknown key id
+const refetchInterval = time.Minute
+
+// allowed clock skew for token expiration check
+const clockSkew = 5 * time.Minute
+
+// TokenVerifier Pub/Sub push JWT token verifier
+type TokenVerifier struct {
+	certsURL       string
+	audience       string
+	serviceAccount string
+	client         *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// last keys fetch attempt, successful or not
+	attemptedAt time.Time
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type tokenClaims struct {
+	Issuer        string `json:"iss"`
+	Audience      string `json:"aud"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	IssuedAt      int64  `json:"iat"`
+	ExpiresAt     int64  `json:"exp"`
+}
+
+type jwks struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// NewTokenVerifier create Pub/Sub push JWT token verifier; empty serviceAccount skips email check
+func NewTokenVerifier(certsURL, audience, serviceAccount string) *TokenVerifier {
+	return &TokenVerifier{
+		certsURL:       certsURL,
+		audience:       audience,
+		serviceAccount: serviceAccount,
+		client:         &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// VerifyRequest verify "Authorization: Bearer <JWT>" header of Pub/Sub push request
+func (v *TokenVerifier) VerifyRequest(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return fmt.Errorf("missing bearer token")
+	}
+	return v.Verify(strings.TrimPrefix(auth, "Bearer "))
+}
+
+// Verify verify RS256 signed JWT token signature and claims
+func (v *TokenVerifier) Verify(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed token")
+	}
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return fmt.Errorf("malformed token header: %v", err)
+	}
+	if header.Alg != "RS256" {
+		return fmt.Errorf("unexpected token algorithm: %s", header.Alg)
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed token signature: %v", err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+		return fmt.Errorf("bad token signature")
+	}
+
+	var claims tokenClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return fmt.Errorf("malformed token claims: %v", err)
+	}
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return fmt.Errorf("token expired")
+	}
+	if claims.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return fmt.Errorf("token used before issued")
+	}
+	if claims.Issuer != "accounts.google.com" && claims.Issuer != "https://accounts.google.com" {
+		return fmt.Errorf("unexpected token issuer: %s", claims.Issuer)
+	}
+	if claims.Audience != v.audience {
+		return fmt.Errorf("unexpected token audience: %s", claims.Audience)
+	}
+	if v.serviceAccount != "" && (claims.Email != v.serviceAccount || !claims.EmailVerified) {
+		return fmt.Errorf("unexpected token email: %s", claims.Email)
+	}
+	return nil
+}
+
+// get public key by id, refreshing keys if unknown or stale; keys are fetched at most once a
+// refetch interval, so unauthenticated requests with random key id cannot flood certs URL
+func (v *TokenVerifier) key(kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.keys[kid]
+	if ok && time.Since(v.fetchedAt) < keysTTL {
+		v.mu.Unlock()
+		return key, nil
+	}
+	if time.Since(v.attemptedAt) < refetchInterval {
+		v.mu.Unlock()
+		// stale key is still better than none, until next fetch
+		if ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown token key: %s", kid)
+	}
+	v.attemptedAt = time.Now()
+	v.mu.Unlock()
+
+	// do not hold lock during fetch: known keys are served meanwhile
+	keys, err := v.fetchKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token keys: %v", err)
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown token key: %s", kid)
+	}
+	return key, nil
+}
+
+func (v *TokenVerifier) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	resp, err := v.client.Get(v.certsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", v.certsURL, resp.Status)
+	}
+	var set jwks
+	if err = json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,224 @@
+package ghcr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// GHCR GitHub Packages container registry (ghcr.io) webhook provider
+type GHCR struct {
+	// secret GitHub webhook secret; signature is not verified if empty
+	secret string
+}
+
+type packageVersion struct {
+	ID                int64  `json:"id"`
+	Version           string `json:"version"`
+	Name              string `json:"name"`
+	HTMLURL           string `json:"html_url"`
+	PackageURL        string `json:"package_url"`
+	CreatedAt         string `json:"created_at"`
+	UpdatedAt         string `json:"updated_at"`
+	ContainerMetadata struct {
+		Tag struct {
+			Name   string `json:"name"`
+			Digest string `json:"digest"`
+		} `json:"tag"`
+	} `json:"container_metadata"`
+	Metadata struct {
+		Container struct {
+			Tags []string `json:"tags"`
+		} `json:"container"`
+	} `json:"metadata"`
+}
+
+type registryPackage struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	Ecosystem   string `json:"ecosystem"`
+	PackageType string `json:"package_type"`
+	HTMLURL     string `json:"html_url"`
+	Owner       struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	PackageVersion packageVersion `json:"package_version"`
+}
+
+type webhookPayload struct {
+	Action string `json:"action"`
+	// registry_package event
+	RegistryPackage *registryPackage `json:"registry_package,omitempty"`
+	// package event
+	Package *registryPackage `json:"package,omitempty"`
+	Sender  struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+func init() {
+	provider.Register(NewGHCR())
+}
+
+// NewGHCR new ghcr provider
+func NewGHCR() *GHCR {
+	return &GHCR{}
+}
+
+// Name provider name
+func (g *GHCR) Name() string {
+	return "ghcr"
+}
+
+// EventType provider event type
+func (g *GHCR) EventType() string {
+	return "registry"
+}
+
+// Flags ghcr command line flags
+func (g *GHCR) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "ghcr-webhook-secret",
+			Usage:  "GitHub webhook secret, used to verify X-Hub-Signature-256 header; signature is not verified if empty",
+			EnvVar: "GHCR_WEBHOOK_SECRET",
+		},
+	}
+}
+
+// Configure set webhook secret
+func (g *GHCR) Configure(c *cli.Context) error {
+	g.secret = c.String("ghcr-webhook-secret")
+	return nil
+}
+
+// EventURI construct GHCR event URI
+func (g *GHCR) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "registry",
+		Provider:  "ghcr",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (g *GHCR) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		NestedName: true,
+		Actions:    []string{"push"},
+	}
+}
+
+// Describe GHCR event info
+func (g *GHCR) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "GitHub Packages",
+		SettingsLink: fmt.Sprintf("https://github.com/organizations/%s/settings/hooks", uri.Namespace),
+		Help:         "GitHub Packages webhooks fire when a new container image version is published to ghcr.io. Subscribe the webhook to 'Packages' or 'Registry packages' events.",
+	}
+}
+
+// ParsePayload parse GitHub registry_package or package webhook payload: one event per container tag
+func (g *GHCR) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	log.Debug("Got GitHub Packages webhook event")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to read webhook payload")
+		return nil, err
+	}
+	if g.secret != "" {
+		if err = VerifySignature(g.secret, c.Request.Header.Get("X-Hub-Signature-256"), body); err != nil {
+			return nil, &provider.AuthError{Reason: err.Error()}
+		}
+	}
+
+	githubEvent := c.Request.Header.Get("X-GitHub-Event")
+	if githubEvent != "registry_package" && githubEvent != "package" {
+		log.Debug(fmt.Sprintf("Skip GitHub event %s", githubEvent))
+		return nil, nil
+	}
+
+	payload := webhookPayload{}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+	pkg := payload.RegistryPackage
+	if pkg == nil {
+		pkg = payload.Package
+	}
+	if pkg == nil || payload.Action != "published" || !strings.EqualFold(pkg.PackageType, "container") {
+		log.Debug(fmt.Sprintf("Skip event %s", payload.Action))
+		return nil, nil
+	}
+
+	owner := pkg.Owner.Login
+	if owner == "" {
+		owner = pkg.Namespace
+	}
+	version := pkg.PackageVersion
+	digest := version.ContainerMetadata.Tag.Digest
+	if digest == "" && strings.HasPrefix(version.Name, "sha256:") {
+		digest = version.Name
+	}
+	tags := version.Metadata.Container.Tags
+	if len(tags) == 0 {
+		tags = []string{version.ContainerMetadata.Tag.Name}
+	}
+
+	var events []*hermes.NormalizedEvent
+	for _, tag := range tags {
+		event := hermes.NewNormalizedEvent()
+		// keep original JSON
+		event.Original = string(body)
+
+		// get image push details
+		event.Variables["namespace"] = owner
+		event.Variables["name"] = pkg.Name
+		event.Variables["tag"] = tag
+		event.Variables["digest"] = digest
+		event.Variables["url"] = version.HTMLURL
+		event.Variables["pusher"] = payload.Sender.Login
+		event.Variables["provider"] = "ghcr"
+		event.Variables["event"] = "push"
+		event.Variables["type"] = "registry"
+		event.Variables["pushed_at"] = version.CreatedAt
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// VerifySignature verify GitHub "sha256=<hex>" HMAC signature of payload
+func VerifySignature(secret, signature string, payload []byte) error {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return fmt.Errorf("missing X-Hub-Signature-256 signature")
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return fmt.Errorf("malformed X-Hub-Signature-256 signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("bad X-Hub-Signature-256 signature")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package ghcr
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func sign(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	data, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		event     string
+		signature string
+		want      int
+		triggered bool
+	}{
+		{"valid signature", "registry_package", sign("WEBHOOK-SECRET", data), http.StatusOK, true},
+		{"package event", "package", sign("WEBHOOK-SECRET", data), http.StatusOK, true},
+		{"missing signature", "registry_package", "", http.StatusUnauthorized, false},
+		{"bad signature", "registry_package", sign("OTHER-SECRET", data), http.StatusUnauthorized, false},
+		{"ping event", "ping", sign("WEBHOOK-SECRET", data), http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", "/ghcr?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Request.Header.Set("X-GitHub-Event", tt.event)
+			if tt.signature != "" {
+				c.Request.Header.Set("X-Hub-Signature-256", tt.signature)
+			}
+
+			// setup mock
+			hermesMock := new(HermesMock)
+			eventURI := "registry:ghcr:octo-org:hello-world:push:cb1e73c5215b"
+			event := hermes.NormalizedEvent{
+				Original: string(data),
+				Secret:   "SECRET",
+				Variables: map[string]string{
+					"namespace":     "octo-org",
+					"name":          "hello-world",
+					"tag":           "v1.2.3",
+					"digest":        "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+					"url":           "https://github.com/orgs/octo-org/packages/container/hello-world/7654321",
+					"pusher":        "octocat",
+					"provider":      "ghcr",
+					"event":         "push",
+					"type":          "registry",
+					"artifact_kind": "image",
+					"pushed_at":     "2021-03-04T10:11:12Z",
+				},
+			}
+			hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
+
+			// bind ghcr to hermes API endpoint
+			ghcr := NewGHCR()
+			ghcr.secret = "WEBHOOK-SECRET"
+			router.POST("/ghcr", provider.NewHandler(ghcr, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.triggered {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package gitlab
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+
+	"github.com/codefresh-io/nomios/pkg/distribution"
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// GitLab GitLab container registry notification provider
+type GitLab struct {
+	// token expected X-Gitlab-Token header value; not validated if empty
+	token string
+}
+
+func init() {
+	provider.Register(NewGitLab())
+}
+
+// NewGitLab new gitlab provider
+func NewGitLab() *GitLab {
+	return &GitLab{}
+}
+
+// Name provider name
+func (g *GitLab) Name() string {
+	return "gitlab"
+}
+
+// EventType provider event type
+func (g *GitLab) EventType() string {
+	return "registry"
+}
+
+// Flags gitlab command line flags
+func (g *GitLab) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "gitlab-token",
+			Usage:  "expected X-Gitlab-Token header value of GitLab registry notifications; not validated if empty",
+			EnvVar: "GITLAB_TOKEN",
+		},
+	}
+}
+
+// Configure set expected token
+func (g *GitLab) Configure(c *cli.Context) error {
+	g.token = c.String("gitlab-token")
+	return nil
+}
+
+// EventURI construct GitLab event URI: name is the full group/subgroup/project[/image] path
+func (g *GitLab) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "registry",
+		Provider:  "gitlab",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// EventID GitLab registry notification id: same for notification retries
+func (g *GitLab) EventID(event *hermes.NormalizedEvent) string {
+	return event.Variables["event_id"]
+}
+
+// URIRule event URI validation rule: namespace is registry host
+func (g *GitLab) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		NestedName: true,
+		Actions:    []string{"push"},
+	}
+}
+
+// Describe GitLab event info
+func (g *GitLab) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "GitLab Container Registry",
+		SettingsLink: "https://docs.gitlab.com/ee/administration/packages/container_registry.html#configure-container-registry-notifications",
+		Help:         "GitLab Container Registry notifications fire when an image manifest is pushed to your project registry.",
+	}
+}
+
+// ParsePayload parse GitLab registry notification envelope: one event per manifest push
+func (g *GitLab) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	log.Debug("Got GitLab registry notification")
+
+	token := c.Request.Header.Get("X-Gitlab-Token")
+	if g.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) != 1 {
+		return nil, &provider.AuthError{Reason: "bad X-Gitlab-Token header"}
+	}
+
+	envelope := distribution.Envelope{}
+	if err := c.BindJSON(&envelope); err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+
+	// verified token is not a trigger secret: with configured token, secret comes from query only
+	secret := c.Query("secret")
+	if g.token == "" {
+		secret = provider.RequestSecret(c, "X-Gitlab-Token")
+	} else if secret == "" {
+		return nil, fmt.Errorf("missing secret query parameter")
+	}
+
+	var events []*hermes.NormalizedEvent
+	for _, e := range envelope.Events {
+		if !distribution.IsManifestPush(&e) {
+			log.Debug(fmt.Sprintf("Skip event %s %s", e.Action, e.Target.MediaType))
+			continue
+		}
+		// multi-platform push: platform manifests are pushed by digest, before tagged index
+		if e.Target.Tag == "" {
+			log.Debug(fmt.Sprintf("Skip untagged manifest push %s@%s", e.Target.Repository, e.Target.Digest))
+			continue
+		}
+		eventJSON, err := json.Marshal(e)
+		if err != nil {
+			log.WithError(err).Error("Failed to covert notification event structure to JSON")
+			return nil, err
+		}
+
+		event := hermes.NewNormalizedEvent()
+		// keep original JSON
+		event.Original = string(eventJSON)
+		event.Secret = secret
+
+		// get image push details
+		event.Variables["namespace"] = e.Request.Host
+		event.Variables["name"] = e.Target.Repository
+		event.Variables["tag"] = e.Target.Tag
+		event.Variables["digest"] = e.Target.Digest
+		event.Variables["media_type"] = e.Target.MediaType
+		event.Variables["url"] = e.Target.URL
+		event.Variables["pusher"] = e.Actor.Name
+		event.Variables["event_id"] = e.ID
+		event.Variables["provider"] = "gitlab"
+		event.Variables["event"] = "push"
+		event.Variables["type"] = "registry"
+		event.Variables["pushed_at"] = e.Timestamp
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,159 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/nomios/pkg/distribution"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	file, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envelope distribution.Envelope
+	if err = json.Unmarshal(file, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := json.Marshal(envelope.Events[0])
+
+	tests := []struct {
+		name      string
+		url       string
+		token     string
+		secret    string
+		want      int
+		triggered bool
+	}{
+		{"query secret", "/gitlab?secret=SECRET&account=cb1e73c5215b", "GITLAB-TOKEN", "SECRET", http.StatusOK, true},
+		{"missing secret", "/gitlab?account=cb1e73c5215b", "GITLAB-TOKEN", "", http.StatusBadRequest, false},
+		{"bad token", "/gitlab?secret=SECRET&account=cb1e73c5215b", "OTHER-TOKEN", "SECRET", http.StatusUnauthorized, false},
+		{"missing token", "/gitlab?secret=SECRET&account=cb1e73c5215b", "", "SECRET", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", tt.url, bytes.NewBuffer(file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				c.Request.Header.Set("X-Gitlab-Token", tt.token)
+			}
+
+			// setup mock: nested group path is kept in the event URI name
+			hermesMock := new(HermesMock)
+			eventURI := "registry:gitlab:registry.gitlab.example.com:my-group/sub-group/my-project/backend:push:cb1e73c5215b"
+			event := hermes.NormalizedEvent{
+				Original: string(original),
+				Secret:   tt.secret,
+				Variables: map[string]string{
+					"namespace":     "registry.gitlab.example.com",
+					"name":          "my-group/sub-group/my-project/backend",
+					"tag":           "v2.0.1",
+					"digest":        "sha256:c1c7fd0d2b6b9f5ac3c9c7ba0f2c1b1f0b3c4a5d6e7f8091a2b3c4d5e6f7a8b9",
+					"media_type":    "application/vnd.docker.distribution.manifest.v2+json",
+					"url":           "https://registry.gitlab.example.com/v2/my-group/sub-group/my-project/backend/manifests/sha256:c1c7fd0d2b6b9f5ac3c9c7ba0f2c1b1f0b3c4a5d6e7f8091a2b3c4d5e6f7a8b9",
+					"pusher":        "project_42_bot",
+					"event_id":      "9a5fbb4f-0d5d-4c6f-9e6b-0d0a5b4f2c11",
+					"provider":      "gitlab",
+					"event":         "push",
+					"type":          "registry",
+					"artifact_kind": "image",
+					"pushed_at":     "2021-05-10T08:15:30.123456789Z",
+				},
+			}
+			hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
+
+			// bind gitlab to hermes API endpoint
+			gitlab := NewGitLab()
+			gitlab.token = "GITLAB-TOKEN"
+			router.POST("/gitlab", provider.NewHandler(gitlab, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.triggered {
+				hermesMock.AssertExpectations(t)
+				hermesMock.AssertNumberOfCalls(t, "TriggerEvent", 1)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestMultiPlatformPush(t *testing.T) {
+	manifest := func(id, mediaType, digest, tag string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":        id,
+			"timestamp": "2021-05-10T08:15:30.123456789Z",
+			"action":    "push",
+			"target": map[string]interface{}{
+				"mediaType":  mediaType,
+				"digest":     digest,
+				"repository": "my-group/my-project/app",
+				"url":        "https://registry.gitlab.example.com/v2/my-group/my-project/app/manifests/" + digest,
+				"tag":        tag,
+			},
+			"request": map[string]string{"host": "registry.gitlab.example.com"},
+			"actor":   map[string]string{"name": "project_42_bot"},
+		}
+	}
+	// platform manifests are pushed by digest, then tagged index
+	data, _ := json.Marshal(map[string]interface{}{
+		"events": []map[string]interface{}{
+			manifest("event-amd64", "application/vnd.oci.image.manifest.v1+json", "sha256:aaaa", ""),
+			manifest("event-arm64", "application/vnd.oci.image.manifest.v1+json", "sha256:bbbb", ""),
+			manifest("event-index", "application/vnd.oci.image.index.v1+json", "sha256:cccc", "v3.0"),
+		},
+	})
+
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+	c.Request, _ = http.NewRequest("POST", "/gitlab?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(data))
+
+	hermesMock := new(HermesMock)
+	hermesMock.On("TriggerEvent", "registry:gitlab:registry.gitlab.example.com:my-group/my-project/app:push:cb1e73c5215b",
+		mock.MatchedBy(func(event *hermes.NormalizedEvent) bool {
+			return event.Variables["tag"] == "v3.0" && event.Variables["digest"] == "sha256:cccc"
+		})).Return(nil)
+
+	router.POST("/gitlab", provider.NewHandler(NewGitLab(), hermesMock))
+	router.HandleContext(c)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status = %v, want %v", rr.Code, http.StatusOK)
+	}
+	hermesMock.AssertExpectations(t)
+	hermesMock.AssertNumberOfCalls(t, "TriggerEvent", 1)
+}
+
+func TestEventID(t *testing.T) {
+	event := hermes.NewNormalizedEvent()
+	event.Variables["event_id"] = "9a5fbb4f-0d5d-4c6f-9e6b-0d0a5b4f2c11"
+	if id := NewGitLab().EventID(event); id != "9a5fbb4f-0d5d-4c6f-9e6b-0d0a5b4f2c11" {
+		t.Errorf("EventID() = %v", id)
+	}
+}
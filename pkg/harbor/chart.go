@@ -0,0 +1,66 @@
+package harbor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// chart metadata request timeout, keeps webhook response in time
+const chartTimeout = 5 * time.Second
+
+// chartClient Harbor chart repository API client; gets chart metadata, missing in UPLOAD_CHART payload
+type chartClient struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+// chart version details, returned by Harbor chart repository API
+type chartVersion struct {
+	Metadata struct {
+		Name       string `json:"name"`
+		Version    string `json:"version"`
+		AppVersion string `json:"appVersion"`
+	} `json:"metadata"`
+}
+
+// newChartClient create chart API client for Harbor base URL; empty username means anonymous access
+func newChartClient(baseURL, username, password string) *chartClient {
+	return &chartClient{
+		url:      baseURL,
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: chartTimeout},
+	}
+}
+
+// appVersion get chart appVersion; chart version is requested from configured Harbor only, never from
+// payload resource URL
+func (c *chartClient) appVersion(project, chart, version string) (string, error) {
+	u := fmt.Sprintf("%s/api/chartrepo/%s/charts/%s/%s", c.url, url.PathEscape(project), url.PathEscape(chart), url.PathEscape(version))
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	var details chartVersion
+	if err = json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		return "", err
+	}
+	return details.Metadata.AppVersion, nil
+}
@@ -0,0 +1,241 @@
+package harbor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// Harbor Harbor registry webhook provider
+//
+// Both registry and helm instances accept artifact and chart events; event URI type depends on event.
+type Harbor struct {
+	eventType string
+	// charts chart repository API client, nil if Harbor URL is not configured
+	charts *chartClient
+}
+
+type scanOverview struct {
+	ScanStatus string `json:"scan_status"`
+	Severity   string `json:"severity"`
+	Summary    struct {
+		Total   int `json:"total"`
+		Fixable int `json:"fixable"`
+	} `json:"summary"`
+}
+
+type webhookPayload struct {
+	Type      string `json:"type"`
+	OccurAt   int64  `json:"occur_at"`
+	Operator  string `json:"operator"`
+	EventData struct {
+		Resources []struct {
+			Digest       string                  `json:"digest"`
+			Tag          string                  `json:"tag"`
+			ResourceURL  string                  `json:"resource_url"`
+			ScanOverview map[string]scanOverview `json:"scan_overview,omitempty"`
+		} `json:"resources"`
+		Repository struct {
+			DateCreated  int64  `json:"date_created"`
+			Name         string `json:"name"`
+			Namespace    string `json:"namespace"`
+			RepoFullName string `json:"repo_full_name"`
+			RepoType     string `json:"repo_type"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+// Harbor event type mapping to event URI type and action
+type eventAction struct {
+	eventType string
+	action    string
+}
+
+var actions = map[string]eventAction{
+	"PUSH_ARTIFACT":      {"registry", "push"},
+	"DELETE_ARTIFACT":    {"registry", "delete"},
+	"SCANNING_COMPLETED": {"registry", "scan"},
+	"UPLOAD_CHART":       {"helm", "push"},
+}
+
+func init() {
+	provider.Register(NewHarbor("registry"))
+	provider.Register(NewHarbor("helm"))
+}
+
+// NewHarbor new harbor provider for event type (registry or helm)
+func NewHarbor(eventType string) *Harbor {
+	return &Harbor{eventType: eventType}
+}
+
+// Name provider name
+func (h *Harbor) Name() string {
+	return "harbor"
+}
+
+// EventType provider event type
+func (h *Harbor) EventType() string {
+	return h.eventType
+}
+
+// Flags harbor command line flags; defined by registry instance only, shared by helm instance
+func (h *Harbor) Flags() []cli.Flag {
+	if h.eventType != "registry" {
+		return nil
+	}
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "harbor-url",
+			Usage:  "Harbor URL, used to get chart appVersion of chart upload events; not requested if empty",
+			EnvVar: "HARBOR_URL",
+		},
+		cli.StringFlag{
+			Name:   "harbor-username",
+			Usage:  "Harbor user (robot account), allowed to read chart repositories; anonymous access if empty",
+			EnvVar: "HARBOR_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "harbor-password",
+			Usage:  "Harbor user password",
+			EnvVar: "HARBOR_PASSWORD",
+		},
+	}
+}
+
+// Configure set Harbor chart repository API client
+func (h *Harbor) Configure(c *cli.Context) error {
+	if u := c.String("harbor-url"); u != "" {
+		h.charts = newChartClient(strings.TrimSuffix(u, "/"), c.String("harbor-username"), c.String("harbor-password"))
+	}
+	return nil
+}
+
+// EventURI construct Harbor event URI; type depends on event
+func (h *Harbor) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      event.Variables["type"],
+		Provider:  "harbor",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    event.Variables["action"],
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// EventID Harbor event identity: tag, digest and event occur time
+func (h *Harbor) EventID(event *hermes.NormalizedEvent) string {
+	return event.Variables["tag"] + "@" + event.Variables["digest"] + "@" + event.Variables["pushed_at"]
+}
+
+// URIRule event URI validation rule
+func (h *Harbor) URIRule() eventuri.Rule {
+	if h.eventType == "helm" {
+		return eventuri.Rule{
+			Actions: []string{"push"},
+		}
+	}
+	return eventuri.Rule{
+		NestedName: true,
+		Actions:    []string{"push", "delete", "scan"},
+	}
+}
+
+// Describe Harbor event info
+func (h *Harbor) Describe(uri *eventuri.URI) provider.Description {
+	if uri.Type == "helm" {
+		return provider.Description{
+			Title:        "Harbor",
+			SettingsLink: "https://goharbor.io/docs/latest/working-with-projects/project-configuration/configure-webhooks/",
+			Help: `Harbor webhooks fire when a helm chart is uploaded to your project chart repository.
+Use the trigger secret either as 'secret' query parameter of the webhook endpoint or as the webhook 'Auth Header' value.`,
+		}
+	}
+	return provider.Description{
+		Title:        "Harbor",
+		SettingsLink: "https://goharbor.io/docs/latest/working-with-projects/project-configuration/configure-webhooks/",
+		Help: `Harbor webhooks fire when an artifact is pushed to, deleted from or scanned in your project repository.
+Use the trigger secret either as 'secret' query parameter of the webhook endpoint or as the webhook 'Auth Header' value.`,
+	}
+}
+
+// ParsePayload parse Harbor webhook payload: one event per resource
+func (h *Harbor) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	log.Debug("Got Harbor webhook event")
+
+	payload := webhookPayload{}
+	if err := c.BindJSON(&payload); err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+
+	action, ok := actions[payload.Type]
+	if !ok {
+		log.Debug(fmt.Sprintf("Skip event %s", payload.Type))
+		return nil, nil
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		log.WithError(err).Error("Failed to covert webhook payload structure to JSON")
+		return nil, err
+	}
+
+	// Harbor webhook "Auth Header" is an alternative to secret query parameter
+	secret := provider.RequestSecret(c, "Authorization")
+
+	repo := payload.EventData.Repository
+	name := strings.TrimPrefix(repo.RepoFullName, repo.Namespace+"/")
+	if name == "" || name == repo.RepoFullName {
+		name = repo.Name
+	}
+
+	var events []*hermes.NormalizedEvent
+	for _, resource := range payload.EventData.Resources {
+		event := hermes.NewNormalizedEvent()
+		// keep original JSON
+		event.Original = string(payloadJSON)
+		event.Secret = secret
+
+		// get artifact details
+		event.Variables["namespace"] = repo.Namespace
+		event.Variables["name"] = name
+		event.Variables["tag"] = resource.Tag
+		if action.eventType == "helm" {
+			event.Variables["version"] = resource.Tag
+			// UPLOAD_CHART payload has no chart metadata: get it from Harbor, when configured
+			if h.charts != nil {
+				if appVersion, err := h.charts.appVersion(repo.Namespace, name, resource.Tag); err != nil {
+					log.WithError(err).WithField("chart", repo.RepoFullName).Warn("Failed to get chart appVersion")
+				} else {
+					event.Variables["app_version"] = appVersion
+				}
+			}
+		}
+		event.Variables["digest"] = resource.Digest
+		event.Variables["resource_url"] = resource.ResourceURL
+		event.Variables["pusher"] = payload.Operator
+		event.Variables["provider"] = "harbor"
+		event.Variables["event"] = payload.Type
+		event.Variables["action"] = action.action
+		event.Variables["type"] = action.eventType
+		event.Variables["pushed_at"] = time.Unix(payload.OccurAt, 0).Format(time.RFC3339)
+		for _, scan := range resource.ScanOverview {
+			event.Variables["scan_status"] = scan.ScanStatus
+			event.Variables["severity"] = scan.Severity
+			event.Variables["vulnerabilities"] = fmt.Sprint(scan.Summary.Total)
+			event.Variables["fixable"] = fmt.Sprint(scan.Summary.Fixable)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,264 @@
+package harbor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func readPayload(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload webhookPayload
+	if err = json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := json.Marshal(payload)
+	return string(original)
+}
+
+func pushEvent(original, secret, tag string) *hermes.NormalizedEvent {
+	return &hermes.NormalizedEvent{
+		Original: original,
+		Secret:   secret,
+		Variables: map[string]string{
+			"namespace":     "test-webhook",
+			"name":          "team/debian",
+			"tag":           tag,
+			"digest":        "sha256:8a9e9863dbb6e10edb5adfe917c00da84e1700fa76e7ed02476aa6e6fb8ee0d8",
+			"resource_url":  "hub.harbor.com/test-webhook/team/debian:" + tag,
+			"pusher":        "admin",
+			"provider":      "harbor",
+			"event":         "PUSH_ARTIFACT",
+			"action":        "push",
+			"type":          "registry",
+			"artifact_kind": "image",
+			"pushed_at":     time.Unix(1586922308, 0).Format(time.RFC3339),
+		},
+	}
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+
+	data := readPayload(t, "./test_payload.json")
+	var err error
+	c.Request, err = http.NewRequest("POST", "/harbor?secret=SECRET&account=cb1e73c5215b", bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Request.Header.Set("Authorization", "IGNORED")
+
+	// setup mock: event per resource
+	hermesMock := new(HermesMock)
+	eventURI := "registry:harbor:test-webhook:team/debian:push:cb1e73c5215b"
+	hermesMock.On("TriggerEvent", eventURI, pushEvent(data, "SECRET", "latest")).Return(nil)
+	hermesMock.On("TriggerEvent", eventURI, pushEvent(data, "SECRET", "1.2.3")).Return(nil)
+
+	// bind harbor to hermes API endpoint
+	router.POST("/harbor", provider.NewHandler(NewHarbor("registry"), hermesMock))
+	router.HandleContext(c)
+
+	// assert expectations
+	hermesMock.AssertExpectations(t)
+	hermesMock.AssertNumberOfCalls(t, "TriggerEvent", 2)
+}
+
+func TestAuthorizationHeaderSecret(t *testing.T) {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+
+	data := readPayload(t, "./test_payload.json")
+	var err error
+	c.Request, err = http.NewRequest("POST", "/harbor?account=cb1e73c5215b", bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Request.Header.Set("Authorization", "HEADER-SECRET")
+
+	hermesMock := new(HermesMock)
+	eventURI := "registry:harbor:test-webhook:team/debian:push:cb1e73c5215b"
+	hermesMock.On("TriggerEvent", eventURI, pushEvent(data, "HEADER-SECRET", "latest")).Return(nil)
+	hermesMock.On("TriggerEvent", eventURI, pushEvent(data, "HEADER-SECRET", "1.2.3")).Return(nil)
+
+	router.POST("/harbor", provider.NewHandler(NewHarbor("registry"), hermesMock))
+	router.HandleContext(c)
+
+	hermesMock.AssertExpectations(t)
+}
+
+func TestScanningCompleted(t *testing.T) {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+
+	data := readPayload(t, "./test_payload_scan.json")
+	var err error
+	c.Request, err = http.NewRequest("POST", "/harbor?secret=SECRET", bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hermesMock := new(HermesMock)
+	eventURI := "registry:harbor:test-webhook:team/debian:scan"
+	event := hermes.NormalizedEvent{
+		Original: data,
+		Secret:   "SECRET",
+		Variables: map[string]string{
+			"namespace":       "test-webhook",
+			"name":            "team/debian",
+			"tag":             "latest",
+			"digest":          "sha256:8a9e9863dbb6e10edb5adfe917c00da84e1700fa76e7ed02476aa6e6fb8ee0d8",
+			"resource_url":    "hub.harbor.com/test-webhook/team/debian:latest",
+			"pusher":          "auto",
+			"provider":        "harbor",
+			"event":           "SCANNING_COMPLETED",
+			"action":          "scan",
+			"type":            "registry",
+			"artifact_kind":   "image",
+			"pushed_at":       time.Unix(1586922408, 0).Format(time.RFC3339),
+			"scan_status":     "Success",
+			"severity":        "High",
+			"vulnerabilities": "12",
+			"fixable":         "7",
+		},
+	}
+	hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
+
+	router.POST("/harbor", provider.NewHandler(NewHarbor("registry"), hermesMock))
+	router.HandleContext(c)
+
+	hermesMock.AssertExpectations(t)
+}
+
+func TestUploadChart(t *testing.T) {
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+
+	data := readPayload(t, "./test_payload_chart.json")
+	var err error
+	c.Request, err = http.NewRequest("POST", "/helm/harbor?secret=SECRET", bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hermesMock := new(HermesMock)
+	eventURI := "helm:harbor:test-webhook:backend:push"
+	event := hermes.NormalizedEvent{
+		Original: data,
+		Secret:   "SECRET",
+		Variables: map[string]string{
+			"namespace":     "test-webhook",
+			"name":          "backend",
+			"tag":           "0.3.0",
+			"version":       "0.3.0",
+			"digest":        "",
+			"resource_url":  "http://hub.harbor.com/chartrepo/test-webhook/charts/backend-0.3.0.tgz",
+			"pusher":        "admin",
+			"provider":      "harbor",
+			"event":         "UPLOAD_CHART",
+			"action":        "push",
+			"type":          "helm",
+			"artifact_kind": "helm-chart",
+			"pushed_at":     time.Unix(1586922508, 0).Format(time.RFC3339),
+		},
+	}
+	hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
+
+	router.POST("/helm/harbor", provider.NewHandler(NewHarbor("helm"), hermesMock))
+	router.HandleContext(c)
+
+	hermesMock.AssertExpectations(t)
+}
+
+func TestUploadChartAppVersion(t *testing.T) {
+	harbor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "robot$nomios" || password != "PASSWORD" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/chartrepo/test-webhook/charts/backend/0.3.0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"metadata":{"name":"backend","version":"0.3.0","appVersion":"2.1.0"}}`))
+	}))
+	defer harbor.Close()
+
+	tests := []struct {
+		name       string
+		password   string
+		appVersion string
+	}{
+		{"app version", "PASSWORD", "2.1.0"},
+		// chart metadata failure does not block event
+		{"unauthorized", "OTHER", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			data := readPayload(t, "./test_payload_chart.json")
+			var err error
+			c.Request, err = http.NewRequest("POST", "/helm/harbor?secret=SECRET", bytes.NewBufferString(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hermesMock := new(HermesMock)
+			hermesMock.On("TriggerEvent", "helm:harbor:test-webhook:backend:push", mock.MatchedBy(func(event *hermes.NormalizedEvent) bool {
+				appVersion, ok := event.Variables["app_version"]
+				return event.Variables["version"] == "0.3.0" && appVersion == tt.appVersion && ok == (tt.appVersion != "")
+			})).Return(nil)
+
+			h := NewHarbor("helm")
+			h.charts = newChartClient(harbor.URL, "robot$nomios", tt.password)
+			router.POST("/helm/harbor", provider.NewHandler(h, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("status = %v, want %v", rr.Code, http.StatusOK)
+			}
+			hermesMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEventID(t *testing.T) {
+	event := hermes.NewNormalizedEvent()
+	event.Variables["tag"] = "latest"
+	event.Variables["digest"] = "sha256:a"
+	event.Variables["pushed_at"] = "2018-04-29T11:15:27Z"
+	h := NewHarbor("registry")
+	if id := h.EventID(event); id != "latest@sha256:a@2018-04-29T11:15:27Z" {
+		t.Errorf("EventID() = %v", id)
+	}
+	// other resource of the same payload
+	other := hermes.NewNormalizedEvent()
+	other.Variables["digest"] = "sha256:b"
+	other.Variables["pushed_at"] = "2018-04-29T11:15:27Z"
+	if h.EventID(other) == h.EventID(event) {
+		t.Errorf("EventID() collision: %v", h.EventID(other))
+	}
+}
@@ -0,0 +1,86 @@
+package hermes
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen Hermes calls fail fast, while circuit breaker is open
+var ErrCircuitOpen = errors.New("hermes circuit breaker is open")
+
+// breaker circuit breaker: opens after threshold consecutive failures, lets single trial
+// call through (half-open) after cooldown, and closes on its success
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	trial     bool
+	now       func() time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow check if call is allowed; disabled breaker (zero threshold) allows all calls
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state() {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// success record successful call: close circuit
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+// failure record failed call: open circuit after threshold failures or failed trial call
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.trial || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.openedAt = b.now()
+	}
+	b.trial = false
+}
+
+// State current circuit breaker state
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+// caller holds lock
+func (b *breaker) state() string {
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return CircuitClosed
+	}
+	if b.now().Sub(b.openedAt) < b.cooldown {
+		return CircuitOpen
+	}
+	return CircuitHalfOpen
+}
@@ -3,8 +3,11 @@ package hermes
 import (
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/dghubble/sling"
 	log "github.com/sirupsen/logrus"
@@ -19,6 +22,39 @@ type (
 	// APIEndpoint Hermes API endpoint
 	APIEndpoint struct {
 		endpoint *sling.Sling
+		options  Options
+		breaker  *breaker
+		sleep    func(time.Duration)
+	}
+
+	// Options Hermes API endpoint request options
+	Options struct {
+		// Timeout single request timeout; no timeout if zero
+		Timeout time.Duration
+		// Retries max retries of failed request (network error, 5xx or 429 response)
+		Retries int
+		// Backoff initial retry backoff, doubled (with jitter) on every retry up to MaxBackoff
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+		// BreakerThreshold consecutive failed requests to open circuit breaker; disabled if zero
+		BreakerThreshold int
+		// BreakerCooldown time to fail fast before trying again
+		BreakerCooldown time.Duration
+	}
+
+	// StatusError Hermes API error response
+	StatusError struct {
+		StatusCode int
+		Status     string
+		EventURI   string
+		// RetryAfter Retry-After response header value, if any
+		RetryAfter time.Duration
+	}
+
+	// DeliveryError failed event delivery, after all attempts
+	DeliveryError struct {
+		Attempts int
+		Err      error
 	}
 
 	// NormalizedEvent normalized event: {event-uri, original-payload, secret, variables-map}
@@ -36,15 +72,148 @@ func NewNormalizedEvent() *NormalizedEvent {
 	return &event
 }
 
-// NewHermesEndpoint create new Hermes API endpoint from url and API token
+// DefaultOptions default Hermes API endpoint options
+func DefaultOptions() Options {
+	return Options{
+		Timeout:          10 * time.Second,
+		Retries:          3,
+		Backoff:          500 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// NewHermesEndpoint create new Hermes API endpoint from url and API token, with default options
 func NewHermesEndpoint(url, token string) Service {
+	return NewHermesEndpointWithOptions(url, token, DefaultOptions())
+}
+
+// NewHermesEndpointWithOptions create new Hermes API endpoint from url, API token and request options
+func NewHermesEndpointWithOptions(url, token string, options Options) *APIEndpoint {
 	log.WithField("hermes url", url).Debug("binding to Hermes service")
-	endpoint := sling.New().Base(url).Set("Authorization", token)
-	return &APIEndpoint{endpoint}
+	client := &http.Client{Timeout: options.Timeout}
+	endpoint := sling.New().Client(client).Base(url).Set("Authorization", token)
+	return &APIEndpoint{
+		endpoint: endpoint,
+		options:  options,
+		breaker:  newBreaker(options.BreakerThreshold, options.BreakerCooldown),
+		sleep:    time.Sleep,
+	}
+}
+
+// CircuitState Hermes circuit breaker state: closed, open or half-open
+func (api *APIEndpoint) CircuitState() string {
+	return api.breaker.State()
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: error triggering event '%s'", e.Status, e.EventURI)
+}
+
+// Temporary check if request may succeed on retry: 5xx or 429 response
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Err.Error()
 }
 
-// TriggerEvent send normalized event to Hermes trigger-manager server
+// Attempts number of Hermes API requests made for failed event delivery: 0 when circuit breaker is open
+func Attempts(err error) int {
+	if e, ok := err.(*DeliveryError); ok {
+		return e.Attempts
+	}
+	if err == ErrCircuitOpen {
+		return 0
+	}
+	return 1
+}
+
+// IsPermanent check if error is a permanent Hermes API failure (4xx response), that should not be retried
+func IsPermanent(err error) bool {
+	if e, ok := err.(*DeliveryError); ok {
+		err = e.Err
+	}
+	if e, ok := err.(*StatusError); ok {
+		return !e.Temporary()
+	}
+	return false
+}
+
+// TriggerEvent send normalized event to Hermes trigger-manager server; retries temporary failures
+// with jittered exponential backoff and fails fast while circuit breaker is open
 func (api *APIEndpoint) TriggerEvent(eventURI string, event *NormalizedEvent) error {
+	backoff := api.options.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := api.breaker.allow(); err != nil {
+			log.WithField("event-uri", eventURI).Warn("Hermes circuit breaker is open, failing fast")
+			if attempt == 0 {
+				return err
+			}
+			return &DeliveryError{Attempts: attempt, Err: err}
+		}
+		err := api.trigger(eventURI, event)
+		if err == nil {
+			api.breaker.success()
+			return nil
+		}
+		if IsPermanent(err) {
+			// Hermes is up, request is bad
+			api.breaker.success()
+			return &DeliveryError{Attempts: attempt + 1, Err: err}
+		}
+		api.breaker.failure()
+		if attempt >= api.options.Retries {
+			return &DeliveryError{Attempts: attempt + 1, Err: err}
+		}
+		wait := jitter(backoff)
+		if e, ok := err.(*StatusError); ok && e.RetryAfter > 0 {
+			// respect Retry-After, but do not park webhook request for long
+			wait = e.RetryAfter
+			if wait > api.options.MaxBackoff {
+				wait = api.options.MaxBackoff
+			}
+		}
+		log.WithError(err).WithFields(log.Fields{
+			"event-uri": eventURI,
+			"attempt":   attempt + 1,
+			"wait":      wait,
+		}).Warn("Failed to invoke Hermes REST API, will retry")
+		api.sleep(wait)
+		if backoff *= 2; backoff > api.options.MaxBackoff {
+			backoff = api.options.MaxBackoff
+		}
+	}
+}
+
+// jitter random duration in [d/2, d)
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// retryAfter parse Retry-After header: delay seconds or HTTP date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// trigger single Hermes trigger request
+func (api *APIEndpoint) trigger(eventURI string, event *NormalizedEvent) error {
 	log.WithField("event-uri", eventURI).Debug("Triggering event")
 	// runs response
 	type PipelineRun struct {
@@ -71,12 +240,22 @@ func (api *APIEndpoint) TriggerEvent(eventURI string, event *NormalizedEvent) er
 	resp, err := api.endpoint.New().Post(fmt.Sprint("run/", url.PathEscape(eventURI))).BodyJSON(event).Receive(&runs, &hermesErr)
 	// ignore EOF JSON parsing error
 	if err != nil && err != io.EOF {
-		log.WithError(err).WithField("api", "POST /run/").Error("failed to invoke Hermes REST API")
-		return err
+		if resp == nil {
+			// network error (or timeout): may retry
+			log.WithError(err).WithField("api", "POST /run/").Error("failed to invoke Hermes REST API")
+			return err
+		}
+		// unexpected response body: status decides, event must not be sent again if accepted
+		log.WithError(err).WithField("api", "POST /run/").Warn("failed to parse Hermes REST API response")
 	}
 	if resp.StatusCode >= 400 {
 		log.WithField("hermes error", hermesErr).WithField("api", "POST /run/").Error("failed to invoke Hermes REST API")
-		return fmt.Errorf("%s: error triggering event '%s'", resp.Status, eventURI)
+		return &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			EventURI:   eventURI,
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 	// if no triggers - no pipeline links
 	if resp.StatusCode == http.StatusNoContent {
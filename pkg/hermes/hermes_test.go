@@ -0,0 +1,214 @@
+package hermes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Hermes server stub, responding with status codes in order (last one repeated)
+type hermesServer struct {
+	mu       sync.Mutex
+	codes    []int
+	header   http.Header
+	requests int
+}
+
+func (h *hermesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	code := h.codes[len(h.codes)-1]
+	if h.requests < len(h.codes) {
+		code = h.codes[h.requests]
+	}
+	h.requests++
+	for k, v := range h.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if code < 300 {
+		w.Write([]byte(`[{"id":"run-1"}]`))
+	} else {
+		w.Write([]byte(`{"message":"error"}`))
+	}
+}
+
+func newTestEndpoint(h *hermesServer, options Options) (*APIEndpoint, *[]time.Duration, func()) {
+	server := httptest.NewServer(h)
+	api := NewHermesEndpointWithOptions(server.URL+"/", "TOKEN", options)
+	var waits []time.Duration
+	api.sleep = func(d time.Duration) { waits = append(waits, d) }
+	return api, &waits, server.Close
+}
+
+func testOptions() Options {
+	options := DefaultOptions()
+	options.Backoff = 100 * time.Millisecond
+	options.MaxBackoff = 300 * time.Millisecond
+	return options
+}
+
+func TestTriggerEventRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int
+		header   http.Header
+		wantErr  bool
+		requests int
+	}{
+		{"success", []int{200}, nil, false, 1},
+		{"no pipelines", []int{204}, nil, false, 1},
+		{"retry 5xx", []int{500, 503, 200}, nil, false, 3},
+		{"retry 429", []int{429, 200}, nil, false, 2},
+		{"no retry 4xx", []int{400}, nil, true, 1},
+		{"no retry 404", []int{404}, nil, true, 1},
+		{"retries exhausted", []int{502}, nil, true, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &hermesServer{codes: tt.codes, header: tt.header}
+			api, waits, stop := newTestEndpoint(h, testOptions())
+			defer stop()
+			err := api.TriggerEvent("registry:dockerhub:codefresh:fortune:push", NewNormalizedEvent())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TriggerEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if h.requests != tt.requests {
+				t.Errorf("requests = %d, want %d", h.requests, tt.requests)
+			}
+			if err != nil && Attempts(err) != tt.requests {
+				t.Errorf("Attempts() = %d, want %d", Attempts(err), tt.requests)
+			}
+			if len(*waits) != tt.requests-1 {
+				t.Errorf("waits = %v", *waits)
+			}
+		})
+	}
+}
+
+func TestTriggerEventBackoff(t *testing.T) {
+	h := &hermesServer{codes: []int{500}}
+	api, waits, stop := newTestEndpoint(h, testOptions())
+	defer stop()
+	api.TriggerEvent("registry:dockerhub:codefresh:fortune:push", NewNormalizedEvent())
+	// backoff: 100ms, 200ms, 300ms (max), with jitter in [d/2, d)
+	limits := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	if len(*waits) != len(limits) {
+		t.Fatalf("waits = %v", *waits)
+	}
+	for i, d := range *waits {
+		if d < limits[i]/2 || d >= limits[i] {
+			t.Errorf("wait[%d] = %v, want in [%v, %v)", i, d, limits[i]/2, limits[i])
+		}
+	}
+}
+
+func TestTriggerEventRetryAfter(t *testing.T) {
+	tests := []struct {
+		retryAfter string
+		want       time.Duration
+	}{
+		{"7", 7 * time.Second},
+		// capped by max backoff
+		{"3600", 10 * time.Second},
+	}
+	for _, tt := range tests {
+		h := &hermesServer{codes: []int{429, 200}, header: http.Header{"Retry-After": []string{tt.retryAfter}}}
+		options := testOptions()
+		options.MaxBackoff = 10 * time.Second
+		api, waits, stop := newTestEndpoint(h, options)
+		if err := api.TriggerEvent("registry:dockerhub:codefresh:fortune:push", NewNormalizedEvent()); err != nil {
+			t.Fatal(err)
+		}
+		stop()
+		if len(*waits) != 1 || (*waits)[0] != tt.want {
+			t.Errorf("Retry-After %s: waits = %v, want [%v]", tt.retryAfter, *waits, tt.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d := retryAfter(""); d != 0 {
+		t.Errorf("retryAfter(\"\") = %v", d)
+	}
+	if d := retryAfter("120"); d != 2*time.Minute {
+		t.Errorf("retryAfter(\"120\") = %v", d)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d := retryAfter(date); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("retryAfter(%q) = %v", date, d)
+	}
+	if d := retryAfter("Wed, 21 Oct 2015 07:28:00 GMT"); d != 0 {
+		t.Errorf("retryAfter(past date) = %v", d)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	h := &hermesServer{codes: []int{500}}
+	options := testOptions()
+	options.Retries = 0
+	options.BreakerThreshold = 2
+	options.BreakerCooldown = time.Minute
+	api, _, stop := newTestEndpoint(h, options)
+	defer stop()
+	now := time.Now()
+	api.breaker.now = func() time.Time { return now }
+
+	uri := "registry:dockerhub:codefresh:fortune:push"
+	api.TriggerEvent(uri, NewNormalizedEvent())
+	if s := api.CircuitState(); s != CircuitClosed {
+		t.Errorf("state after 1 failure = %s", s)
+	}
+	api.TriggerEvent(uri, NewNormalizedEvent())
+	if s := api.CircuitState(); s != CircuitOpen {
+		t.Fatalf("state after 2 failures = %s", s)
+	}
+
+	// fail fast
+	if err := api.TriggerEvent(uri, NewNormalizedEvent()); err != ErrCircuitOpen {
+		t.Errorf("TriggerEvent() error = %v, want ErrCircuitOpen", err)
+	} else if Attempts(err) != 0 {
+		t.Errorf("Attempts() = %d, want 0", Attempts(err))
+	}
+	if h.requests != 2 {
+		t.Errorf("requests = %d, want 2", h.requests)
+	}
+
+	// failed trial call opens circuit again
+	now = now.Add(time.Minute)
+	if s := api.CircuitState(); s != CircuitHalfOpen {
+		t.Errorf("state after cooldown = %s", s)
+	}
+	api.TriggerEvent(uri, NewNormalizedEvent())
+	if s := api.CircuitState(); s != CircuitOpen || h.requests != 3 {
+		t.Errorf("state after failed trial = %s, requests = %d", s, h.requests)
+	}
+
+	// successful trial call closes circuit
+	now = now.Add(time.Minute)
+	h.codes = []int{200}
+	if err := api.TriggerEvent(uri, NewNormalizedEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if s := api.CircuitState(); s != CircuitClosed {
+		t.Errorf("state after successful trial = %s", s)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	h := &hermesServer{codes: []int{400}}
+	options := testOptions()
+	options.BreakerThreshold = 1
+	api, _, stop := newTestEndpoint(h, options)
+	defer stop()
+	err := api.TriggerEvent("registry:dockerhub:codefresh:fortune:push", NewNormalizedEvent())
+	if !IsPermanent(err) {
+		t.Errorf("IsPermanent(%v) = false", err)
+	}
+	if s := api.CircuitState(); s != CircuitClosed {
+		t.Errorf("state = %s, want closed", s)
+	}
+}
@@ -3,75 +3,156 @@ package jfrog
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
-	"net/http"
-	"time"
+	"github.com/urfave/cli"
 )
 
-// JFrog struct
+// JFrog JFrog Artifactory docker registry webhook provider; supports both legacy
+// `artifactory.webhook` plugin and Artifactory 7 native webhooks
 type JFrog struct {
-	hermesSvc hermes.Service
+	// secret JFrog webhook secret; signature is not verified if empty
+	secret string
+	// allowUnsignedLegacy accept unsigned legacy plugin payloads, even if secret is set
+	allowUnsignedLegacy bool
 }
 
 type webhookPayload struct {
 	Artifactory struct {
 		Webhook struct {
-			Event string `json:event`
+			Event string `json:"event"`
 			Data  struct {
 				Docker struct {
-					Tag   string `json:tag`
-					Image string `json:image`
-				} `json:docker`
+					Tag   string `json:"tag"`
+					Image string `json:"image"`
+				} `json:"docker"`
 				Event struct {
-					ModifiedBy string `json:modifiedBy`
-					Created    int64  `json:created`
+					ModifiedBy string `json:"modifiedBy"`
+					Created    int64  `json:"created"`
 					RepoPath   struct {
-						RepoKey string `json:repoKey`
-					} `json:repoPath`
-				} `json:event`
-			} `json:data`
+						RepoKey string `json:"repoKey"`
+					} `json:"repoPath"`
+				} `json:"event"`
+			} `json:"data"`
 		} `json:"webhook"`
 	} `json:"artifactory"`
 }
 
-// NewJFrog new jfrog handler
-func NewJFrog(svc hermes.Service) *JFrog {
-	return &JFrog{svc}
+func init() {
+	provider.Register(NewJFrog())
+}
+
+// NewJFrog new jfrog provider
+func NewJFrog() *JFrog {
+	return &JFrog{}
 }
 
-func constructEventURI(payload *webhookPayload, account string) string {
-	uri := fmt.Sprintf("registry:jfrog:%s:%s:push", payload.Artifactory.Webhook.Data.Event.RepoPath.RepoKey, payload.Artifactory.Webhook.Data.Docker.Image)
-	if account != "" {
-		uri = fmt.Sprintf("%s:%s", uri, account)
+// Name provider name
+func (d *JFrog) Name() string {
+	return "jfrog"
+}
+
+// EventType provider event type
+func (d *JFrog) EventType() string {
+	return "registry"
+}
+
+// Flags jfrog command line flags
+func (d *JFrog) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   SecretFlag,
+			Usage:  "JFrog Artifactory webhook secret, used to verify X-JFrog-Event-Auth header; signature is not verified if empty",
+			EnvVar: "JFROG_SECRET",
+		},
+		cli.BoolFlag{
+			Name:   AllowUnsignedLegacyFlag,
+			Usage:  "accept unsigned legacy artifactory.webhook plugin payloads, even if JFrog webhook secret is set",
+			EnvVar: "JFROG_ALLOW_UNSIGNED_LEGACY",
+		},
 	}
-	return uri
 }
 
-// HandleWebhook handle JFrog webhook
-func (d *JFrog) HandleWebhook(c *gin.Context) {
-	log.Debug("Got JFrog webhook event")
+// Configure set webhook secret
+func (d *JFrog) Configure(c *cli.Context) error {
+	d.secret = c.String(SecretFlag)
+	d.allowUnsignedLegacy = c.Bool(AllowUnsignedLegacyFlag)
+	return nil
+}
+
+// EventURI construct JFrog event URI
+func (d *JFrog) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "registry",
+		Provider:  "jfrog",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (d *JFrog) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		NestedName: true,
+		Actions:    []string{"push"},
+	}
+}
+
+// Describe JFrog event info
+func (d *JFrog) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "JFrog Artifactory",
+		SettingsLink: "https://codefresh.io/docs/docs/configure-ci-cd-pipeline/triggers/jfrog-triggers/",
+	}
+}
+
+// ParsePayload parse JFrog webhook payload; payload format is auto-detected
+func (d *JFrog) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to read webhook payload")
+		return nil, err
+	}
+	native, err := ParseEvent(body)
+	if err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+	// legacy plugin payloads are not signed: accept them unsigned only if explicitly allowed
+	if d.secret != "" && (native != nil || !d.allowUnsignedLegacy) {
+		if err = VerifySignature(d.secret, c.Request.Header.Get("X-JFrog-Event-Auth"), body); err != nil {
+			return nil, &provider.AuthError{Reason: err.Error()}
+		}
+	}
+	if native != nil {
+		return nativeEvents(native, string(body))
+	}
 
 	payload := webhookPayload{}
-	if err := c.BindJSON(&payload); err != nil {
+	if err = json.Unmarshal(body, &payload); err != nil {
 		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 
 	if payload.Artifactory.Webhook.Event != "docker.tagCreated" {
 		log.Debug(fmt.Sprintf("Skip event %s", payload.Artifactory.Webhook.Event))
-		return
+		return nil, nil
 	}
 
 	event := hermes.NewNormalizedEvent()
-	eventURI := constructEventURI(&payload, c.Query("account"))
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		log.WithError(err).Error("Failed to covert webhook payload structure to JSON")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 	// keep original JSON
 	event.Original = string(payloadJSON)
@@ -86,18 +167,34 @@ func (d *JFrog) HandleWebhook(c *gin.Context) {
 	event.Variables["pusher"] = payload.Artifactory.Webhook.Data.Event.ModifiedBy
 	event.Variables["pushed_at"] = time.Unix(int64(payload.Artifactory.Webhook.Data.Event.Created/1000), 0).Format(time.RFC3339)
 
-	// get secret from URL query
-	event.Secret = c.Query("secret")
+	return []*hermes.NormalizedEvent{event}, nil
+}
+
+// Artifactory 7 docker "pushed" event
+func nativeEvents(native *Event, original string) ([]*hermes.NormalizedEvent, error) {
+	if native.Domain != "docker" || native.EventType != "pushed" {
+		log.Debug(fmt.Sprintf("Skip event %s.%s", native.Domain, native.EventType))
+		return nil, nil
+	}
 
-	log.Debug("Event url " + eventURI)
+	event := hermes.NewNormalizedEvent()
+	// keep original JSON
+	event.Original = original
 
-	// invoke trigger
-	err = d.hermesSvc.TriggerEvent(eventURI, event)
-	if err != nil {
-		log.WithError(err).Error("Failed to trigger event pipelines")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	// get image push details
+	event.Variables["event"] = native.Domain + "." + native.EventType
+	event.Variables["namespace"] = native.Data.RepoKey
+	event.Variables["name"] = native.Data.ImageName
+	event.Variables["tag"] = native.Data.Tag
+	if native.Data.SHA256 != "" {
+		event.Variables["digest"] = "sha256:" + native.Data.SHA256
+	}
+	if len(native.Data.Platforms) > 0 {
+		event.Variables["platforms"] = PlatformList(native.Data.Platforms)
 	}
+	event.Variables["path"] = native.Data.Path
+	event.Variables["provider"] = "jfrog"
+	event.Variables["type"] = "registry"
 
-	c.Status(http.StatusOK)
+	return []*hermes.NormalizedEvent{event}, nil
 }
@@ -2,6 +2,9 @@ package jfrog
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +13,7 @@ import (
 	"time"
 
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/mock"
 )
@@ -51,23 +55,157 @@ func TestContextBindWithQuery(t *testing.T) {
 		Original: string(data),
 		Secret:   "SECRET",
 		Variables: map[string]string{
-			"event":     "docker.tagCreated",
-			"namespace": "local",
-			"name":      "test",
-			"tag":       "tagName",
-			"pusher":    "admin",
-			"provider":  "jfrog",
-			"type":      "registry",
-			"pushed_at": time.Unix(1540479021, 0).Format(time.RFC3339),
+			"event":         "docker.tagCreated",
+			"namespace":     "local",
+			"name":          "test",
+			"tag":           "tagName",
+			"pusher":        "admin",
+			"provider":      "jfrog",
+			"type":          "registry",
+			"artifact_kind": "image",
+			"pushed_at":     time.Unix(1540479021, 0).Format(time.RFC3339),
 		},
 	}
 	hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
 
 	// bind dockerhub to hermes API endpoint
-	jfrog := NewJFrog(hermesMock)
-	router.POST("/jfrog", jfrog.HandleWebhook)
+	router.POST("/jfrog", provider.NewHandler(NewJFrog(), hermesMock))
 	router.HandleContext(c)
 
 	// assert expectations
 	hermesMock.AssertExpectations(t)
 }
+
+func sign(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNativeWebhook(t *testing.T) {
+	native, err := ioutil.ReadFile("./test_payload_v7.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		signature string
+		eventURI  string
+		variables map[string]string
+		// allowLegacy accept unsigned legacy payloads
+		allowLegacy bool
+		want        int
+	}{
+		{
+			name:      "docker pushed",
+			data:      native,
+			signature: sign("JFROG-SECRET", native),
+			eventURI:  "registry:jfrog:docker-local:team/app:push:cb1e73c5215b",
+			variables: map[string]string{
+				"event":         "docker.pushed",
+				"namespace":     "docker-local",
+				"name":          "team/app",
+				"tag":           "1.0.0",
+				"digest":        "sha256:80f0d5c8786bb9e621a45ece0db56d11cdc624ad20da9fe62e9d25490f331d7d",
+				"platforms":     "linux/amd64,linux/arm64",
+				"path":          "team/app/1.0.0/manifest.json",
+				"provider":      "jfrog",
+				"type":          "registry",
+				"artifact_kind": "image",
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:      "legacy payload with signature",
+			data:      legacy,
+			signature: sign("JFROG-SECRET", legacy),
+			eventURI:  "registry:jfrog:local:test:push:cb1e73c5215b",
+			want:      http.StatusOK,
+		},
+		{
+			name: "legacy payload without signature",
+			data: legacy,
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:        "allowed legacy payload without signature",
+			data:        legacy,
+			allowLegacy: true,
+			eventURI:    "registry:jfrog:local:test:push:cb1e73c5215b",
+			want:        http.StatusOK,
+		},
+		{
+			name:        "native payload without signature, legacy allowed",
+			data:        native,
+			allowLegacy: true,
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name:      "bad signature",
+			data:      native,
+			signature: sign("OTHER-SECRET", native),
+			want:      http.StatusUnauthorized,
+		},
+		{
+			name: "missing signature",
+			data: native,
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:      "docker deleted",
+			data:      bytes.Replace(native, []byte(`"event_type": "pushed"`), []byte(`"event_type": "deleted"`), 1),
+			signature: sign("JFROG-SECRET", bytes.Replace(native, []byte(`"event_type": "pushed"`), []byte(`"event_type": "deleted"`), 1)),
+			want:      http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", "/jfrog?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.signature != "" {
+				c.Request.Header.Set("X-JFrog-Event-Auth", tt.signature)
+			}
+
+			// setup mock
+			hermesMock := new(HermesMock)
+			if tt.eventURI != "" {
+				if tt.variables != nil {
+					event := hermes.NormalizedEvent{
+						Original:  string(tt.data),
+						Secret:    "SECRET",
+						Variables: tt.variables,
+					}
+					hermesMock.On("TriggerEvent", tt.eventURI, &event).Return(nil)
+				} else {
+					hermesMock.On("TriggerEvent", tt.eventURI, mock.Anything).Return(nil)
+				}
+			}
+
+			// bind jfrog to hermes API endpoint
+			jfrog := NewJFrog()
+			jfrog.secret = "JFROG-SECRET"
+			jfrog.allowUnsignedLegacy = tt.allowLegacy
+			router.POST("/jfrog", provider.NewHandler(jfrog, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.eventURI != "" {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package jfrog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Event JFrog Artifactory 7 (native) webhook event
+type Event struct {
+	Domain          string    `json:"domain"`
+	EventType       string    `json:"event_type"`
+	Data            EventData `json:"data"`
+	SubscriptionKey string    `json:"subscription_key,omitempty"`
+	JPDOrigin       string    `json:"jpd_origin,omitempty"`
+	Source          string    `json:"source,omitempty"`
+}
+
+// EventData JFrog Artifactory 7 webhook event data; docker domain events have image fields
+type EventData struct {
+	RepoKey   string     `json:"repo_key"`
+	Path      string     `json:"path"`
+	Name      string     `json:"name"`
+	Size      int64      `json:"size,omitempty"`
+	SHA256    string     `json:"sha256,omitempty"`
+	ImageName string     `json:"image_name,omitempty"`
+	Tag       string     `json:"tag,omitempty"`
+	Platforms []Platform `json:"platforms,omitempty"`
+}
+
+// Platform docker image platform
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// SecretFlag JFrog webhook secret flag, shared by all JFrog providers
+const SecretFlag = "jfrog-secret"
+
+// AllowUnsignedLegacyFlag accept unsigned legacy plugin payloads flag, shared by all JFrog providers
+const AllowUnsignedLegacyFlag = "jfrog-allow-unsigned-legacy"
+
+// ParseEvent parse JFrog Artifactory 7 webhook event; returns nil event for legacy
+// `artifactory.webhook` plugin payload
+func ParseEvent(body []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	if event.Domain == "" || event.EventType == "" {
+		return nil, nil
+	}
+	return &event, nil
+}
+
+// VerifySignature verify JFrog X-JFrog-Event-Auth HMAC-SHA256 hex signature of payload
+func VerifySignature(secret, signature string, payload []byte) error {
+	if signature == "" {
+		return fmt.Errorf("missing X-JFrog-Event-Auth signature")
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("malformed X-JFrog-Event-Auth signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("bad X-JFrog-Event-Auth signature")
+	}
+	return nil
+}
+
+// PlatformList comma separated os/architecture list
+func PlatformList(platforms []Platform) string {
+	list := make([]string, 0, len(platforms))
+	for _, p := range platforms {
+		list = append(list, p.OS+"/"+p.Architecture)
+	}
+	return strings.Join(list, ",")
+}
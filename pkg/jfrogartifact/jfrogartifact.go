@@ -0,0 +1,176 @@
+package jfrogartifact
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/jfrog"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// JFrogArtifact JFrog Artifactory generic artifact webhook provider, for any (binary, npm, Maven, ...)
+// repository; handles Artifactory 7 "artifact.deployed" webhooks
+type JFrogArtifact struct {
+	// secret JFrog webhook secret; signature is not verified if empty
+	secret string
+}
+
+const deployedAction = "deployed"
+
+func init() {
+	provider.Register(NewJFrogArtifact())
+}
+
+// NewJFrogArtifact new jfrog artifact provider
+func NewJFrogArtifact() *JFrogArtifact {
+	return &JFrogArtifact{}
+}
+
+// Name provider name
+func (d *JFrogArtifact) Name() string {
+	return "jfrog"
+}
+
+// EventType provider event type
+func (d *JFrogArtifact) EventType() string {
+	return "artifact"
+}
+
+// Flags none, shares jfrog registry provider flags
+func (d *JFrogArtifact) Flags() []cli.Flag {
+	return nil
+}
+
+// Configure set webhook secret; flag is defined by jfrog registry provider
+func (d *JFrogArtifact) Configure(c *cli.Context) error {
+	d.secret = c.String(jfrog.SecretFlag)
+	return nil
+}
+
+// EventURI construct JFrog artifact event URI; name is artifact path in repository
+func (d *JFrogArtifact) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "artifact",
+		Provider:  "jfrog",
+		Namespace: event.Variables["repo"],
+		Name:      event.Variables["path"],
+		Action:    deployedAction,
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (d *JFrogArtifact) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		NestedName: true,
+		Actions:    []string{deployedAction},
+	}
+}
+
+// Describe JFrog artifact event info
+func (d *JFrogArtifact) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "JFrog Artifactory",
+		SettingsLink: "https://www.jfrog.com/confluence/display/JFROG/Webhooks",
+		Help:         "JFrog Artifactory webhooks fire when an artifact is deployed to your repository. Create an Artifact webhook with 'Artifact was deployed' event. Add 'path' query parameter with a glob pattern (for example 'com/acme/**/*.jar') to ignore other artifacts; '*' matches within a single path segment and '**' matches any number of segments.",
+	}
+}
+
+// ParsePayload parse JFrog Artifactory 7 artifact webhook payload; artifacts not matching
+// "path" glob query parameter are skipped
+func (d *JFrogArtifact) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to read webhook payload")
+		return nil, err
+	}
+	if d.secret != "" {
+		if err = jfrog.VerifySignature(d.secret, c.Request.Header.Get("X-JFrog-Event-Auth"), body); err != nil {
+			return nil, &provider.AuthError{Reason: err.Error()}
+		}
+	}
+
+	native, err := jfrog.ParseEvent(body)
+	if err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+	if native == nil {
+		return nil, fmt.Errorf("unsupported JFrog artifact webhook payload")
+	}
+	if native.Domain != "artifact" || native.EventType != deployedAction {
+		log.Debug(fmt.Sprintf("Skip event %s.%s", native.Domain, native.EventType))
+		return nil, nil
+	}
+	if glob := c.Query("path"); glob != "" {
+		matched, err := MatchPath(glob, native.Data.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			log.Debug(fmt.Sprintf("Skip artifact %s not matching %s", native.Data.Path, glob))
+			return nil, nil
+		}
+	}
+	log.WithFields(log.Fields{
+		"repo": native.Data.RepoKey,
+		"path": native.Data.Path,
+	}).Debug("Got JFrog artifact webhook event")
+
+	event := hermes.NewNormalizedEvent()
+	// keep original JSON
+	event.Original = string(body)
+
+	// get artifact details
+	event.Variables["event"] = native.Domain + "." + native.EventType
+	event.Variables["repo"] = native.Data.RepoKey
+	event.Variables["path"] = native.Data.Path
+	event.Variables["name"] = native.Data.Name
+	event.Variables["size"] = fmt.Sprint(native.Data.Size)
+	event.Variables["sha256"] = native.Data.SHA256
+	event.Variables["provider"] = "jfrog"
+	event.Variables["type"] = "artifact"
+
+	return []*hermes.NormalizedEvent{event}, nil
+}
+
+// MatchPath match '/' separated artifact path against glob pattern; pattern segments use
+// path.Match syntax and "**" segment matches zero or more path segments
+func MatchPath(pattern, name string) (bool, error) {
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(name, "/"), "/"))
+}
+
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// try to match rest of pattern at every position
+			for i := 0; i <= len(name); i++ {
+				matched, err := matchSegments(pattern[1:], name[i:])
+				if err != nil || matched {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil {
+			return false, fmt.Errorf("bad path pattern: %v", err)
+		}
+		if !matched {
+			return false, nil
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
@@ -0,0 +1,165 @@
+package jfrogartifact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func sign(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	data, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	docker := bytes.Replace(data, []byte(`"domain": "artifact"`), []byte(`"domain": "docker"`), 1)
+
+	tests := []struct {
+		name      string
+		query     string
+		data      []byte
+		signature string
+		eventURI  string
+		want      int
+	}{
+		{
+			name:      "artifact deployed",
+			data:      data,
+			signature: sign("JFROG-SECRET", data),
+			eventURI:  "artifact:jfrog:libs-release-local:com/acme/app/1.2.0/app-1.2.0.jar:deployed:cb1e73c5215b",
+			want:      http.StatusOK,
+		},
+		{
+			name:      "matching path",
+			query:     "&path=com/acme/**/*.jar",
+			data:      data,
+			signature: sign("JFROG-SECRET", data),
+			eventURI:  "artifact:jfrog:libs-release-local:com/acme/app/1.2.0/app-1.2.0.jar:deployed:cb1e73c5215b",
+			want:      http.StatusOK,
+		},
+		{
+			name:      "not matching path",
+			query:     "&path=com/acme/**/*.pom",
+			data:      data,
+			signature: sign("JFROG-SECRET", data),
+			want:      http.StatusOK,
+		},
+		{
+			name:      "bad path pattern",
+			query:     "&path=com/[acme",
+			data:      data,
+			signature: sign("JFROG-SECRET", data),
+			want:      http.StatusBadRequest,
+		},
+		{
+			name:      "bad signature",
+			data:      data,
+			signature: sign("OTHER-SECRET", data),
+			want:      http.StatusUnauthorized,
+		},
+		{
+			name:      "docker event",
+			data:      docker,
+			signature: sign("JFROG-SECRET", docker),
+			want:      http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", "/artifact/jfrog?secret=SECRET&account=cb1e73c5215b"+tt.query, bytes.NewBuffer(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Request.Header.Set("X-JFrog-Event-Auth", tt.signature)
+
+			// setup mock
+			hermesMock := new(HermesMock)
+			if tt.eventURI != "" {
+				event := hermes.NormalizedEvent{
+					Original: string(tt.data),
+					Secret:   "SECRET",
+					Variables: map[string]string{
+						"event":    "artifact.deployed",
+						"repo":     "libs-release-local",
+						"path":     "com/acme/app/1.2.0/app-1.2.0.jar",
+						"name":     "app-1.2.0.jar",
+						"size":     "1048576",
+						"sha256":   "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+						"provider": "jfrog",
+						"type":     "artifact",
+					},
+				}
+				hermesMock.On("TriggerEvent", tt.eventURI, &event).Return(nil)
+			}
+
+			// bind jfrog artifact to hermes API endpoint
+			artifact := NewJFrogArtifact()
+			artifact.secret = "JFROG-SECRET"
+			router.POST("/artifact/jfrog", provider.NewHandler(artifact, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.eventURI != "" {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"com/acme/**/*.jar", "com/acme/app/1.2.0/app-1.2.0.jar", true},
+		{"com/acme/**", "com/acme/app/1.2.0/app-1.2.0.jar", true},
+		{"**/*.tgz", "app/-/app-1.0.0.tgz", true},
+		{"**/*.tgz", "app-1.0.0.tgz", true},
+		{"com/acme/*.jar", "com/acme/app/1.2.0/app-1.2.0.jar", false},
+		{"tools/*/bin", "tools/v1/bin", true},
+		{"tools/*/bin", "tools/v1/bin/cli", false},
+		{"/tools/**/", "tools/v1/bin", true},
+	}
+	for _, tt := range tests {
+		got, err := MatchPath(tt.pattern, tt.path)
+		if err != nil {
+			t.Errorf("MatchPath(%q, %q) error = %v", tt.pattern, tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -3,75 +3,148 @@ package jfroghelm
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/jfrog"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
-	"net/http"
-	"time"
+	"github.com/urfave/cli"
 )
 
-// JFrog struct
+// JFrogHelm JFrog Artifactory helm repository webhook provider; supports both legacy
+// `artifactory.webhook` plugin and Artifactory 7 native webhooks
 type JFrogHelm struct {
-	hermesSvc hermes.Service
+	// secret JFrog webhook secret; signature is not verified if empty
+	secret string
+	// allowUnsignedLegacy accept unsigned legacy plugin payloads, even if secret is set
+	allowUnsignedLegacy bool
 }
 
 type webhookPayload struct {
 	Artifactory struct {
 		Webhook struct {
-			Event string `json:event`
+			Event string `json:"event"`
 			Data  struct {
-				ModifiedBy string `json:modifiedBy`
-				Created    int64  `json:created`
+				ModifiedBy string `json:"modifiedBy"`
+				Created    int64  `json:"created"`
 				RepoPath   struct {
-					RepoKey string `json:repoKey`
-					Name    string `json:name`
-				} `json:repoPath`
-			} `json:data`
+					RepoKey string `json:"repoKey"`
+					Name    string `json:"name"`
+				} `json:"repoPath"`
+			} `json:"data"`
 		} `json:"webhook"`
 	} `json:"artifactory"`
 }
 
-// NewJFrog new jfrog handler
-func NewJFrog(svc hermes.Service) *JFrogHelm {
-	return &JFrogHelm{svc}
+func init() {
+	provider.Register(NewJFrog())
+}
+
+// NewJFrog new jfrog helm provider
+func NewJFrog() *JFrogHelm {
+	return &JFrogHelm{}
+}
+
+// Name provider name
+func (d *JFrogHelm) Name() string {
+	return "jfrog"
+}
+
+// EventType provider event type
+func (d *JFrogHelm) EventType() string {
+	return "helm"
+}
+
+// Flags none, shares jfrog registry provider flags
+func (d *JFrogHelm) Flags() []cli.Flag {
+	return nil
+}
+
+// Configure set webhook secret; flag is defined by jfrog registry provider
+func (d *JFrogHelm) Configure(c *cli.Context) error {
+	d.secret = c.String(jfrog.SecretFlag)
+	d.allowUnsignedLegacy = c.Bool(jfrog.AllowUnsignedLegacyFlag)
+	return nil
+}
+
+// EventURI construct JFrog helm event URI
+func (d *JFrogHelm) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "helm",
+		Provider:  "jfrog",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    "push",
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (d *JFrogHelm) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		Actions: []string{"push"},
+	}
 }
 
-func constructEventURI(payload *webhookPayload, account string) string {
-	uri := fmt.Sprintf("helm:jfrog:%s:%s:push", payload.Artifactory.Webhook.Data.RepoPath.RepoKey, payload.Artifactory.Webhook.Data.RepoPath.Name)
-	if account != "" {
-		uri = fmt.Sprintf("%s:%s", uri, account)
+// Describe JFrog helm event info
+func (d *JFrogHelm) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "JFrog Artifactory",
+		SettingsLink: "https://codefresh.io/docs/docs/configure-ci-cd-pipeline/triggers/jfrog-triggers/",
 	}
-	return uri
 }
 
-// HandleWebhook handle JFrog webhook
-func (d *JFrogHelm) HandleWebhook(c *gin.Context) {
+// ParsePayload parse JFrog helm webhook payload; payload format is auto-detected
+func (d *JFrogHelm) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
 	log.Info("Got JFrog Helm webhook event")
 
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to read webhook payload")
+		return nil, err
+	}
+	native, err := jfrog.ParseEvent(body)
+	if err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+	// legacy plugin payloads are not signed: accept them unsigned only if explicitly allowed
+	if d.secret != "" && (native != nil || !d.allowUnsignedLegacy) {
+		if err = jfrog.VerifySignature(d.secret, c.Request.Header.Get("X-JFrog-Event-Auth"), body); err != nil {
+			return nil, &provider.AuthError{Reason: err.Error()}
+		}
+	}
+	if native != nil {
+		return nativeEvents(native, string(body))
+	}
+
 	payload := webhookPayload{}
-	if err := c.BindJSON(&payload); err != nil {
+	if err = json.Unmarshal(body, &payload); err != nil {
 		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 
 	if payload.Artifactory.Webhook.Event != "storage.afterCreate" {
 		log.Debug(fmt.Sprintf("Skip event %s", payload.Artifactory.Webhook.Event))
-		return
+		return nil, nil
 	}
 
 	event := hermes.NewNormalizedEvent()
-	eventURI := constructEventURI(&payload, c.Query("account"))
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		log.WithError(err).Error("Failed to covert webhook payload structure to JSON")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 	// keep original JSON
 	event.Original = string(payloadJSON)
 
-	// get image push details
+	// get chart push details
 	event.Variables["event"] = payload.Artifactory.Webhook.Event
 	event.Variables["namespace"] = payload.Artifactory.Webhook.Data.RepoPath.RepoKey
 	event.Variables["name"] = payload.Artifactory.Webhook.Data.RepoPath.Name
@@ -80,18 +153,30 @@ func (d *JFrogHelm) HandleWebhook(c *gin.Context) {
 	event.Variables["pusher"] = payload.Artifactory.Webhook.Data.ModifiedBy
 	event.Variables["pushed_at"] = time.Unix(int64(payload.Artifactory.Webhook.Data.Created/1000), 0).Format(time.RFC3339)
 
-	// get secret from URL query
-	event.Secret = c.Query("secret")
-
-	log.Debug("Event url " + eventURI)
+	return []*hermes.NormalizedEvent{event}, nil
+}
 
-	// invoke trigger
-	err = d.hermesSvc.TriggerEvent(eventURI, event)
-	if err != nil {
-		log.WithError(err).Error("Failed to trigger event pipelines")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+// Artifactory 7 chart archive "deployed" event; chart archive name is used as event name,
+// same as legacy payload
+func nativeEvents(native *jfrog.Event, original string) ([]*hermes.NormalizedEvent, error) {
+	if native.Domain != "artifact" || native.EventType != "deployed" || !strings.HasSuffix(native.Data.Name, ".tgz") {
+		log.Debug(fmt.Sprintf("Skip event %s.%s %s", native.Domain, native.EventType, native.Data.Name))
+		return nil, nil
 	}
 
-	c.Status(http.StatusOK)
+	event := hermes.NewNormalizedEvent()
+	// keep original JSON
+	event.Original = original
+
+	// get chart push details
+	event.Variables["event"] = native.Domain + "." + native.EventType
+	event.Variables["namespace"] = native.Data.RepoKey
+	event.Variables["name"] = native.Data.Name
+	event.Variables["path"] = native.Data.Path
+	event.Variables["sha256"] = native.Data.SHA256
+	event.Variables["size"] = fmt.Sprint(native.Data.Size)
+	event.Variables["provider"] = "jfrog"
+	event.Variables["type"] = "helm"
+
+	return []*hermes.NormalizedEvent{event}, nil
 }
@@ -2,6 +2,9 @@ package jfroghelm
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +13,7 @@ import (
 	"time"
 
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/mock"
 )
@@ -51,22 +55,155 @@ func TestContextBindWithQuery(t *testing.T) {
 		Original: string(data),
 		Secret:   "SECRET",
 		Variables: map[string]string{
-			"event":     "storage.afterCreate",
-			"namespace": "local",
-			"name":      "name",
-			"pusher":    "admin",
-			"provider":  "jfrog",
-			"type":      "helm",
-			"pushed_at": time.Unix(1540479021, 0).Format(time.RFC3339),
+			"event":         "storage.afterCreate",
+			"namespace":     "local",
+			"name":          "name",
+			"pusher":        "admin",
+			"provider":      "jfrog",
+			"type":          "helm",
+			"artifact_kind": "helm-chart",
+			"pushed_at":     time.Unix(1540479021, 0).Format(time.RFC3339),
 		},
 	}
 	hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
 
 	// bind dockerhub to hermes API endpoint
-	jfroghelm := NewJFrog(hermesMock)
-	router.POST("/helm/jfrog", jfroghelm.HandleWebhook)
+	router.POST("/helm/jfrog", provider.NewHandler(NewJFrog(), hermesMock))
 	router.HandleContext(c)
 
 	// assert expectations
 	hermesMock.AssertExpectations(t)
 }
+
+func sign(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNativeWebhook(t *testing.T) {
+	native, err := ioutil.ReadFile("./test_payload_v7.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		signature string
+		eventURI  string
+		variables map[string]string
+		// allowLegacy accept unsigned legacy payloads
+		allowLegacy bool
+		want        int
+	}{
+		{
+			name:      "chart deployed",
+			data:      native,
+			signature: sign("JFROG-SECRET", native),
+			eventURI:  "helm:jfrog:helm-local:wordpress-5.4.0.tgz:push:cb1e73c5215b",
+			variables: map[string]string{
+				"event":         "artifact.deployed",
+				"namespace":     "helm-local",
+				"name":          "wordpress-5.4.0.tgz",
+				"path":          "wordpress-5.4.0.tgz",
+				"sha256":        "4f3a8f2b0c1d9e7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a",
+				"size":          "25265",
+				"provider":      "jfrog",
+				"type":          "helm",
+				"artifact_kind": "helm-chart",
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:      "legacy payload with signature",
+			data:      legacy,
+			signature: sign("JFROG-SECRET", legacy),
+			eventURI:  "helm:jfrog:local:name:push:cb1e73c5215b",
+			want:      http.StatusOK,
+		},
+		{
+			name: "legacy payload without signature",
+			data: legacy,
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:        "allowed legacy payload without signature",
+			data:        legacy,
+			allowLegacy: true,
+			eventURI:    "helm:jfrog:local:name:push:cb1e73c5215b",
+			want:        http.StatusOK,
+		},
+		{
+			name:        "native payload without signature, legacy allowed",
+			data:        native,
+			allowLegacy: true,
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name:      "bad signature",
+			data:      native,
+			signature: sign("OTHER-SECRET", native),
+			want:      http.StatusUnauthorized,
+		},
+		{
+			name: "missing signature",
+			data: native,
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:      "non chart artifact",
+			data:      bytes.Replace(native, []byte(`"name": "wordpress-5.4.0.tgz"`), []byte(`"name": "wordpress-5.4.0.jar"`), 1),
+			signature: sign("JFROG-SECRET", bytes.Replace(native, []byte(`"name": "wordpress-5.4.0.tgz"`), []byte(`"name": "wordpress-5.4.0.jar"`), 1)),
+			want:      http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", "/helm/jfrog?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.signature != "" {
+				c.Request.Header.Set("X-JFrog-Event-Auth", tt.signature)
+			}
+
+			// setup mock
+			hermesMock := new(HermesMock)
+			if tt.eventURI != "" {
+				if tt.variables != nil {
+					event := hermes.NormalizedEvent{
+						Original:  string(tt.data),
+						Secret:    "SECRET",
+						Variables: tt.variables,
+					}
+					hermesMock.On("TriggerEvent", tt.eventURI, &event).Return(nil)
+				} else {
+					hermesMock.On("TriggerEvent", tt.eventURI, mock.Anything).Return(nil)
+				}
+			}
+
+			// bind jfrog helm to hermes API endpoint
+			helm := NewJFrog()
+			helm.secret = "JFROG-SECRET"
+			helm.allowUnsignedLegacy = tt.allowLegacy
+			router.POST("/helm/jfrog", provider.NewHandler(helm, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.eventURI != "" {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
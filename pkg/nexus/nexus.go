@@ -0,0 +1,200 @@
+package nexus
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// Nexus Sonatype Nexus Repository component webhook provider
+//
+// Both registry and helm instances accept docker and helm components; event URI type depends on component format.
+type Nexus struct {
+	eventType string
+	// secret Nexus webhook secret; signature is not verified if empty
+	secret string
+}
+
+type webhookPayload struct {
+	Timestamp      string `json:"timestamp"`
+	NodeID         string `json:"nodeId"`
+	Initiator      string `json:"initiator"`
+	RepositoryName string `json:"repositoryName"`
+	Action         string `json:"action"`
+	Component      struct {
+		ID          string `json:"id"`
+		ComponentID string `json:"componentId"`
+		Format      string `json:"format"`
+		Name        string `json:"name"`
+		Group       string `json:"group"`
+		Version     string `json:"version"`
+	} `json:"component"`
+}
+
+// component formats and matching event types
+var eventTypes = map[string]string{
+	"docker": "registry",
+	"helm":   "helm",
+}
+
+// Nexus actions and matching event URI actions
+var actions = map[string]string{
+	"CREATED": "push",
+	"UPDATED": "push",
+	"DELETED": "delete",
+}
+
+func init() {
+	provider.Register(NewNexus("registry"))
+	provider.Register(NewNexus("helm"))
+}
+
+// NewNexus new nexus provider for event type (registry or helm)
+func NewNexus(eventType string) *Nexus {
+	return &Nexus{eventType: eventType}
+}
+
+// Name provider name
+func (n *Nexus) Name() string {
+	return "nexus"
+}
+
+// EventType provider event type
+func (n *Nexus) EventType() string {
+	return n.eventType
+}
+
+// Flags nexus command line flags; registered once, by registry instance
+func (n *Nexus) Flags() []cli.Flag {
+	if n.eventType != "registry" {
+		return nil
+	}
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "nexus-secret",
+			Usage:  "Nexus webhook secret key, used to verify X-Nexus-Webhook-Signature header; signature is not verified if empty",
+			EnvVar: "NEXUS_SECRET",
+		},
+	}
+}
+
+// Configure set webhook secret
+func (n *Nexus) Configure(c *cli.Context) error {
+	n.secret = c.String("nexus-secret")
+	return nil
+}
+
+// EventURI construct Nexus event URI; type depends on component format
+func (n *Nexus) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      event.Variables["type"],
+		Provider:  "nexus",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    event.Variables["action"],
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (n *Nexus) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		NestedName: n.eventType == "registry",
+		Actions:    []string{"push", "delete"},
+	}
+}
+
+// Describe Nexus event info
+func (n *Nexus) Describe(uri *eventuri.URI) provider.Description {
+	return provider.Description{
+		Title:        "Nexus Repository",
+		SettingsLink: "https://help.sonatype.com/repomanager3/integrations/webhooks",
+		Help:         "Nexus Repository webhooks fire when a docker image or helm chart component is created, updated or deleted in your repository. Create a Repository webhook with 'component' event type.",
+	}
+}
+
+// ParsePayload parse Nexus rm:repository:component webhook payload
+func (n *Nexus) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	log.Debug("Got Nexus webhook event")
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to read webhook payload")
+		return nil, err
+	}
+	if n.secret != "" {
+		if err = VerifySignature(n.secret, c.Request.Header.Get("X-Nexus-Webhook-Signature"), body); err != nil {
+			return nil, &provider.AuthError{Reason: err.Error()}
+		}
+	}
+
+	if id := c.Request.Header.Get("X-Nexus-Webhook-ID"); id != "" && id != "rm:repository:component" {
+		log.Debug(fmt.Sprintf("Skip webhook %s", id))
+		return nil, nil
+	}
+
+	payload := webhookPayload{}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+
+	eventType, ok := eventTypes[payload.Component.Format]
+	if !ok {
+		log.Debug(fmt.Sprintf("Skip %s component", payload.Component.Format))
+		return nil, nil
+	}
+	action, ok := actions[payload.Action]
+	if !ok {
+		log.Debug(fmt.Sprintf("Skip event %s", payload.Action))
+		return nil, nil
+	}
+
+	event := hermes.NewNormalizedEvent()
+	// keep original JSON
+	event.Original = string(body)
+
+	// get component details; initiator is {user}/{ip}
+	event.Variables["namespace"] = payload.RepositoryName
+	event.Variables["name"] = payload.Component.Name
+	event.Variables["tag"] = payload.Component.Version
+	event.Variables["format"] = payload.Component.Format
+	event.Variables["component_id"] = payload.Component.ComponentID
+	event.Variables["pusher"] = strings.SplitN(payload.Initiator, "/", 2)[0]
+	event.Variables["provider"] = "nexus"
+	event.Variables["event"] = payload.Action
+	event.Variables["action"] = action
+	event.Variables["type"] = eventType
+	event.Variables["pushed_at"] = payload.Timestamp
+
+	return []*hermes.NormalizedEvent{event}, nil
+}
+
+// VerifySignature verify Nexus HMAC-SHA1 hex signature of payload
+func VerifySignature(secret, signature string, payload []byte) error {
+	if signature == "" {
+		return fmt.Errorf("missing X-Nexus-Webhook-Signature signature")
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("malformed X-Nexus-Webhook-Signature signature")
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("bad X-Nexus-Webhook-Signature signature")
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package nexus
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+func sign(secret string, data []byte) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestContextBindWithQuery(t *testing.T) {
+	docker, err := ioutil.ReadFile("./test_payload.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	helm, err := ioutil.ReadFile("./test_payload_helm.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		signature string
+		eventURI  string
+		variables map[string]string
+		want      int
+	}{
+		{
+			name:      "docker component",
+			data:      docker,
+			signature: sign("NEXUS-SECRET", docker),
+			eventURI:  "registry:nexus:docker-hosted:team/backend:push:cb1e73c5215b",
+			variables: map[string]string{
+				"namespace":     "docker-hosted",
+				"name":          "team/backend",
+				"tag":           "1.4.2",
+				"format":        "docker",
+				"component_id":  "ZG9ja2VyLWhvc3RlZDowODkwOWJmMGM4NmNmNmM5NjAwYWFkZTg5ZTFjNWUyNQ",
+				"pusher":        "admin",
+				"provider":      "nexus",
+				"event":         "CREATED",
+				"action":        "push",
+				"type":          "registry",
+				"artifact_kind": "image",
+				"pushed_at":     "2021-06-01T12:34:56.789+0000",
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:      "helm component",
+			data:      helm,
+			signature: sign("NEXUS-SECRET", helm),
+			eventURI:  "helm:nexus:helm-hosted:backend:push:cb1e73c5215b",
+			variables: map[string]string{
+				"namespace":     "helm-hosted",
+				"name":          "backend",
+				"tag":           "0.3.0",
+				"format":        "helm",
+				"component_id":  "aGVsbS1ob3N0ZWQ6MWYzYTljMmI3ZDhlNGY1MGE2YjFjMmQzZTRmNWE2Yjc",
+				"pusher":        "deployer",
+				"provider":      "nexus",
+				"event":         "UPDATED",
+				"action":        "push",
+				"type":          "helm",
+				"artifact_kind": "helm-chart",
+				"pushed_at":     "2021-06-01T12:40:00.000+0000",
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:      "bad signature",
+			data:      docker,
+			signature: sign("OTHER-SECRET", docker),
+			want:      http.StatusUnauthorized,
+		},
+		{
+			name: "missing signature",
+			data: docker,
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:      "maven component",
+			data:      bytes.Replace(docker, []byte(`"docker"`), []byte(`"maven2"`), 1),
+			signature: sign("NEXUS-SECRET", bytes.Replace(docker, []byte(`"docker"`), []byte(`"maven2"`), 1)),
+			want:      http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", "/nexus?secret=SECRET&account=cb1e73c5215b", bytes.NewBuffer(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Request.Header.Set("X-Nexus-Webhook-ID", "rm:repository:component")
+			if tt.signature != "" {
+				c.Request.Header.Set("X-Nexus-Webhook-Signature", tt.signature)
+			}
+
+			// setup mock
+			hermesMock := new(HermesMock)
+			if tt.eventURI != "" {
+				event := hermes.NormalizedEvent{
+					Original:  string(tt.data),
+					Secret:    "SECRET",
+					Variables: tt.variables,
+				}
+				hermesMock.On("TriggerEvent", tt.eventURI, &event).Return(nil)
+			}
+
+			// bind nexus to hermes API endpoint
+			nexus := NewNexus("registry")
+			nexus.secret = "NEXUS-SECRET"
+			router.POST("/nexus", provider.NewHandler(nexus, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.eventURI != "" {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
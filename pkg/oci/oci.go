@@ -0,0 +1,111 @@
+package oci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Artifact kinds, set as "artifact_kind" event variable
+const (
+	KindImage       = "image"
+	KindIndex       = "index"
+	KindSignature   = "signature"
+	KindAttestation = "attestation"
+	KindSBOM        = "sbom"
+	KindHelmChart   = "helm-chart"
+)
+
+// Kinds all known artifact kinds
+var Kinds = []string{KindImage, KindIndex, KindSignature, KindAttestation, KindSBOM, KindHelmChart}
+
+// DefaultKinds artifact kinds accepted by webhook endpoint, unless it opts in to other kinds
+var DefaultKinds = []string{KindImage, KindIndex, KindHelmChart}
+
+// manifest, config and artifact media types and matching artifact kinds
+var mediaTypes = map[string]string{
+	"application/vnd.docker.distribution.manifest.v1+json":      KindImage,
+	"application/vnd.docker.distribution.manifest.v1+prettyjws": KindImage,
+	"application/vnd.docker.distribution.manifest.v2+json":      KindImage,
+	"application/vnd.oci.image.manifest.v1+json":                KindImage,
+	"application/vnd.docker.distribution.manifest.list.v2+json": KindIndex,
+	"application/vnd.oci.image.index.v1+json":                   KindIndex,
+	// helm charts
+	"application/vnd.cncf.helm.config.v1+json":            KindHelmChart,
+	"application/vnd.cncf.helm.chart.content.v1.tar+gzip": KindHelmChart,
+	"application/vnd.acr.helm.chart":                      KindHelmChart,
+	// signatures
+	"application/vnd.dev.cosign.simplesigning.v1+json": KindSignature,
+	"application/vnd.dev.cosign.artifact.sig.v1+json":  KindSignature,
+	"application/vnd.cncf.notary.signature":            KindSignature,
+	// attestations
+	"application/vnd.dsse.envelope.v1+json":           KindAttestation,
+	"application/vnd.in-toto+json":                    KindAttestation,
+	"application/vnd.dev.cosign.artifact.att.v1+json": KindAttestation,
+	// SBOMs
+	"application/vnd.cyclonedx+json":                   KindSBOM,
+	"application/vnd.cyclonedx+xml":                    KindSBOM,
+	"application/spdx+json":                            KindSBOM,
+	"text/spdx":                                        KindSBOM,
+	"application/vnd.syft+json":                        KindSBOM,
+	"application/vnd.dev.cosign.artifact.sbom.v1+json": KindSBOM,
+}
+
+// cosign attached artifact tag: sha256-<digest>.<sig|att|sbom>
+var cosignTag = regexp.MustCompile(`^sha256-[a-f0-9]{64}\.(sig|att|sbom)$`)
+
+var cosignKinds = map[string]string{
+	"sig":  KindSignature,
+	"att":  KindAttestation,
+	"sbom": KindSBOM,
+}
+
+// Classify get artifact kind from artifact type, manifest media type and tag; artifact type
+// (OCI artifact manifest or config media type) wins over manifest media type, and cosign tag
+// pattern wins over generic image manifest media type
+func Classify(mediaType, artifactType, tag string) string {
+	if kind, ok := mediaTypes[artifactType]; ok && kind != KindImage && kind != KindIndex {
+		return kind
+	}
+	if m := cosignTag.FindStringSubmatch(tag); m != nil {
+		return cosignKinds[m[1]]
+	}
+	if kind, ok := mediaTypes[mediaType]; ok {
+		return kind
+	}
+	return KindImage
+}
+
+// ParseKinds parse comma separated artifact kinds list; empty list means default kinds and "all" means all kinds
+func ParseKinds(list string) (map[string]bool, error) {
+	kinds := make(map[string]bool)
+	switch strings.TrimSpace(list) {
+	case "":
+		for _, k := range DefaultKinds {
+			kinds[k] = true
+		}
+		return kinds, nil
+	case "all":
+		for _, k := range Kinds {
+			kinds[k] = true
+		}
+		return kinds, nil
+	}
+	for _, k := range strings.Split(list, ",") {
+		k = strings.TrimSpace(k)
+		if !isKind(k) {
+			return nil, fmt.Errorf("unknown artifact kind: %q", k)
+		}
+		kinds[k] = true
+	}
+	return kinds, nil
+}
+
+func isKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
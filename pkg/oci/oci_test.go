@@ -0,0 +1,59 @@
+package oci
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	digest := "8a9e9863dbb6e10edb5adfe917c00da84e1700fa76e7ed02476aa6e6fb8ee0d8"
+	tests := []struct {
+		name         string
+		mediaType    string
+		artifactType string
+		tag          string
+		want         string
+	}{
+		{"unknown", "", "", "latest", KindImage},
+		{"docker image", "application/vnd.docker.distribution.manifest.v2+json", "", "1.0.0", KindImage},
+		{"oci index", "application/vnd.oci.image.index.v1+json", "", "1.0.0", KindIndex},
+		{"manifest list", "application/vnd.docker.distribution.manifest.list.v2+json", "", "1.0.0", KindIndex},
+		{"cosign signature tag", "application/vnd.oci.image.manifest.v1+json", "", "sha256-" + digest + ".sig", KindSignature},
+		{"cosign attestation tag", "", "", "sha256-" + digest + ".att", KindAttestation},
+		{"cosign sbom tag", "", "", "sha256-" + digest + ".sbom", KindSBOM},
+		{"not a cosign tag", "", "", "sha256-1234.sig", KindImage},
+		{"notary signature", "application/vnd.oci.image.manifest.v1+json", "application/vnd.cncf.notary.signature", "", KindSignature},
+		{"spdx sbom", "application/vnd.oci.image.manifest.v1+json", "application/spdx+json", "", KindSBOM},
+		{"in-toto attestation", "application/vnd.oci.image.manifest.v1+json", "application/vnd.in-toto+json", "", KindAttestation},
+		{"oci helm chart", "application/vnd.oci.image.manifest.v1+json", "application/vnd.cncf.helm.config.v1+json", "0.3.0", KindHelmChart},
+		{"acr helm chart", "application/vnd.acr.helm.chart", "", "0.3.0", KindHelmChart},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.mediaType, tt.artifactType, tt.tag); got != tt.want {
+			t.Errorf("Classify() %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseKinds(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{"", map[string]bool{KindImage: true, KindIndex: true, KindHelmChart: true}, false},
+		{"all", map[string]bool{KindImage: true, KindIndex: true, KindSignature: true, KindAttestation: true, KindSBOM: true, KindHelmChart: true}, false},
+		{"image, signature", map[string]bool{KindImage: true, KindSignature: true}, false},
+		{"image,binary", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseKinds(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKinds(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseKinds(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
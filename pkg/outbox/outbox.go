@@ -0,0 +1,362 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/deadletter"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Record outbox log record: persisted event or delivery acknowledgement
+	Record struct {
+		ID       uint64                  `json:"id"`
+		Op       string                  `json:"op"`
+		Time     time.Time               `json:"time"`
+		EventURI string                  `json:"uri,omitempty"`
+		Event    *hermes.NormalizedEvent `json:"event,omitempty"`
+	}
+
+	// Outbox durable append-only event outbox; events are persisted on TriggerEvent and
+	// delivered to Hermes service by background dispatcher, at least once
+	Outbox struct {
+		mu      sync.Mutex
+		path    string
+		file    *os.File
+		nextID  uint64
+		pending []*entry
+		// acked ack records since last compaction
+		acked  int
+		svc    hermes.Service
+		retry  time.Duration
+		notify chan struct{}
+		// dead letter store for events, that failed delivery maxAttempts times or permanently
+		deadLetters *deadletter.Store
+		maxAttempts int
+	}
+
+	// pending event delivery state
+	entry struct {
+		record      *Record
+		attempts    int
+		nextAttempt time.Time
+	}
+)
+
+// outbox log record operations
+const (
+	opEvent = "event"
+	opAck   = "ack"
+)
+
+// compact outbox log after this number of acknowledged events
+const compactThreshold = 1000
+
+// log file name in outbox directory
+const logFile = "outbox.log"
+
+// Open open (or create) outbox in directory, loading pending events of previous run; failed deliveries
+// are retried every retry interval
+func Open(dir string, svc hermes.Service, retry time.Duration) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	o := &Outbox{
+		path:   filepath.Join(dir, logFile),
+		svc:    svc,
+		retry:  retry,
+		notify: make(chan struct{}, 1),
+	}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	// start with compacted log: pending events only
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"path":    o.path,
+		"pending": len(o.pending),
+	}).Debug("Opened event outbox")
+	return o, nil
+}
+
+// TriggerEvent persist event in outbox; event is delivered by dispatcher
+func (o *Outbox) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.nextID++
+	record := &Record{ID: o.nextID, Op: opEvent, Time: time.Now().UTC(), EventURI: eventURI, Event: event}
+	if err := o.append(record); err != nil {
+		log.WithError(err).WithField("event-uri", eventURI).Error("Failed to persist event in outbox")
+		return err
+	}
+	o.pending = append(o.pending, &entry{record: record})
+	log.WithFields(log.Fields{
+		"event-uri": eventURI,
+		"id":        record.ID,
+	}).Debug("Event persisted in outbox")
+	// wake up dispatcher
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetDeadLetters move events to dead letter store on permanent delivery failure (4xx response) or
+// after maxAttempts failed Hermes requests (0 for unlimited); events are retried forever otherwise
+func (o *Outbox) SetDeadLetters(store *deadletter.Store, maxAttempts int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.deadLetters = store
+	o.maxAttempts = maxAttempts
+}
+
+// Pending number of not yet delivered events
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Run deliver pending events until stop channel is closed
+func (o *Outbox) Run(stop <-chan struct{}) {
+	for {
+		wait := o.dispatch()
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-o.notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Close close outbox log file
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.file.Close()
+}
+
+// dispatch deliver all due pending events, in order; returns time to wait for next due event
+func (o *Outbox) dispatch() time.Duration {
+	now := time.Now()
+	o.mu.Lock()
+	var due []*entry
+	for _, e := range o.pending {
+		if !e.nextAttempt.After(now) {
+			due = append(due, e)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, e := range due {
+		err := o.svc.TriggerEvent(e.record.EventURI, e.record.Event)
+		o.mu.Lock()
+		if err != nil {
+			e.attempts += hermes.Attempts(err)
+		} else {
+			e.attempts++
+		}
+		if err != nil && o.deadLetter(e, err) {
+			o.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			e.nextAttempt = time.Now().Add(o.retry)
+			log.WithError(err).WithFields(log.Fields{
+				"event-uri": e.record.EventURI,
+				"id":        e.record.ID,
+				"attempts":  e.attempts,
+			}).Warn("Failed to deliver outbox event, will retry")
+		} else if err = o.ack(e); err != nil {
+			// event stays pending and will be delivered again
+			e.nextAttempt = time.Now().Add(o.retry)
+			log.WithError(err).WithField("id", e.record.ID).Error("Failed to acknowledge outbox event")
+		}
+		o.mu.Unlock()
+	}
+
+	// wait for next retry or new event
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	wait := o.retry
+	for _, e := range o.pending {
+		if d := e.nextAttempt.Sub(time.Now()); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// deadLetter move failed event to dead letter store, if delivery should not be retried; caller holds lock
+func (o *Outbox) deadLetter(e *entry, err error) bool {
+	if o.deadLetters == nil {
+		return false
+	}
+	if !hermes.IsPermanent(err) && (o.maxAttempts <= 0 || e.attempts < o.maxAttempts) {
+		return false
+	}
+	if _, serr := o.deadLetters.Add(e.record.EventURI, e.record.Event, err, e.attempts); serr != nil {
+		log.WithError(serr).WithField("id", e.record.ID).Error("Failed to add outbox event to dead letter store")
+		return false
+	}
+	if aerr := o.ack(e); aerr != nil {
+		// event stays pending and may be delivered or dead-lettered again
+		e.nextAttempt = time.Now().Add(o.retry)
+		log.WithError(aerr).WithField("id", e.record.ID).Error("Failed to acknowledge outbox event")
+	}
+	return true
+}
+
+// ack persist delivery acknowledgement and remove event from pending list; caller holds lock
+func (o *Outbox) ack(e *entry) error {
+	if err := o.append(&Record{ID: e.record.ID, Op: opAck, Time: time.Now().UTC()}); err != nil {
+		return err
+	}
+	for i, p := range o.pending {
+		if p == e {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			break
+		}
+	}
+	o.acked++
+	if o.acked >= compactThreshold {
+		if err := o.compact(); err != nil {
+			log.WithError(err).Error("Failed to compact outbox")
+		}
+	}
+	return nil
+}
+
+// append write record to log file and sync it to disk; caller holds lock
+func (o *Outbox) append(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = o.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+// load read log file: events without acknowledgement are pending
+func (o *Outbox) load() error {
+	f, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	events := make(map[uint64]*Record)
+	var order []uint64
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) > 0 {
+				// partial write of last record, on crash
+				log.WithField("path", o.path).Warn("Skip incomplete outbox record")
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var record Record
+		if err = json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("bad outbox record %s:%d: %v", o.path, line, err)
+		}
+		if record.ID > o.nextID {
+			o.nextID = record.ID
+		}
+		switch record.Op {
+		case opEvent:
+			events[record.ID] = &record
+			order = append(order, record.ID)
+		case opAck:
+			delete(events, record.ID)
+		}
+	}
+	for _, id := range order {
+		if record, ok := events[id]; ok {
+			o.pending = append(o.pending, &entry{record: record})
+		}
+	}
+	return nil
+}
+
+// compact rewrite log file with pending events only; caller holds lock (or outbox is not shared yet)
+func (o *Outbox) compact() error {
+	tmp := o.path + ".tmp"
+	// temporary file becomes log file after rename: keep its handle for appends, nothing to reopen
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_APPEND|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// leave no partial temporary file behind
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range o.pending {
+		data, err := json.Marshal(e.record)
+		if err != nil {
+			return fail(err)
+		}
+		if _, err = w.Write(append(data, '\n')); err != nil {
+			return fail(err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err = f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err = os.Rename(tmp, o.path); err != nil {
+		return fail(err)
+	}
+	// make rename durable
+	if err = syncDir(filepath.Dir(o.path)); err != nil {
+		log.WithError(err).Warn("Failed to sync outbox directory")
+	}
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file = f
+	o.acked = 0
+	return nil
+}
+
+// fsync directory, persisting its entries (renamed files)
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,263 @@
+package outbox
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/deadletter"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+)
+
+// recording Hermes service, failing while down
+type hermesStub struct {
+	mu        sync.Mutex
+	down      bool
+	delivered []string
+	attempts  int
+}
+
+func (h *hermesStub) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.attempts++
+	if h.down {
+		return errors.New("hermes is down")
+	}
+	h.delivered = append(h.delivered, eventURI)
+	return nil
+}
+
+func (h *hermesStub) setDown(down bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.down = down
+}
+
+func (h *hermesStub) deliveredURIs() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.delivered...)
+}
+
+func newEvent(tag string) *hermes.NormalizedEvent {
+	event := hermes.NewNormalizedEvent()
+	event.Secret = "SECRET"
+	event.Variables["tag"] = tag
+	return event
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDeliverInOrder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	svc := &hermesStub{}
+	o, err := Open(dir, svc, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	for _, uri := range []string{"registry:dockerhub:team:app:push", "registry:quay:team:app:push"} {
+		if err = o.TriggerEvent(uri, newEvent("latest")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o.dispatch()
+
+	got := svc.deliveredURIs()
+	if len(got) != 2 || got[0] != "registry:dockerhub:team:app:push" || got[1] != "registry:quay:team:app:push" {
+		t.Errorf("delivered = %v", got)
+	}
+	if o.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", o.Pending())
+	}
+}
+
+func TestSurviveRestart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// hermes is down: events stay pending
+	svc := &hermesStub{down: true}
+	o, err := Open(dir, svc, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.TriggerEvent("registry:dockerhub:team:app:push", newEvent("1.0"))
+	o.TriggerEvent("registry:dockerhub:team:app:push", newEvent("1.1"))
+	o.dispatch()
+	if o.Pending() != 2 {
+		t.Fatalf("Pending() = %d, want 2", o.Pending())
+	}
+	o.Close()
+
+	// restart: pending events are loaded and delivered
+	svc = &hermesStub{}
+	o, err = Open(dir, svc, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Pending() != 2 {
+		t.Fatalf("Pending() after restart = %d, want 2", o.Pending())
+	}
+	o.dispatch()
+	if got := svc.deliveredURIs(); len(got) != 2 {
+		t.Errorf("delivered after restart = %v", got)
+	}
+	o.TriggerEvent("registry:dockerhub:team:app:push", newEvent("1.2"))
+	o.Close()
+
+	// restart again: only new event is pending; delivered events are not sent again
+	o, err = Open(dir, &hermesStub{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if o.Pending() != 1 || o.pending[0].record.Event.Variables["tag"] != "1.2" || o.pending[0].record.ID != 3 {
+		t.Errorf("pending after second restart = %d", o.Pending())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	svc := &hermesStub{down: true}
+	o, err := Open(dir, svc, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		o.Run(stop)
+		close(done)
+	}()
+	o.TriggerEvent("registry:dockerhub:team:app:push", newEvent("latest"))
+	time.Sleep(50 * time.Millisecond)
+	svc.setDown(false)
+
+	deadline := time.Now().Add(time.Second)
+	for o.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	if o.Pending() != 0 || len(svc.deliveredURIs()) != 1 {
+		t.Errorf("Pending() = %d, delivered = %v", o.Pending(), svc.deliveredURIs())
+	}
+	if svc.attempts < 2 {
+		t.Errorf("attempts = %d, want retries", svc.attempts)
+	}
+}
+
+func TestIncompleteRecord(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	o, err := Open(dir, &hermesStub{down: true}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.TriggerEvent("registry:dockerhub:team:app:push", newEvent("latest"))
+	o.Close()
+
+	// simulate crash during write
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":2,"op":"event","uri":"registry:dock`)
+	f.Close()
+
+	o, err = Open(dir, &hermesStub{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if o.Pending() != 1 {
+		t.Errorf("Pending() = %d, want 1", o.Pending())
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	svc := &hermesStub{}
+	o, err := Open(dir, svc, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < compactThreshold; i++ {
+		o.TriggerEvent("registry:dockerhub:team:app:push", newEvent("latest"))
+	}
+	o.dispatch()
+
+	info, err := os.Stat(filepath.Join(dir, logFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 || o.acked != 0 {
+		t.Errorf("outbox log size = %d, acked = %d; want compacted log", info.Size(), o.acked)
+	}
+
+	// events appended after compaction survive restart
+	svc.setDown(true)
+	o.TriggerEvent("registry:dockerhub:team:app:push", newEvent("1.0"))
+	o.Close()
+	if o, err = Open(dir, svc, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if len(o.pending) != 1 || o.pending[0].record.Event.Variables["tag"] != "1.0" {
+		t.Errorf("pending = %d events after restart, want 1", len(o.pending))
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := deadletter.Open(filepath.Join(dir, "deadletters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	svc := &hermesStub{down: true}
+	o, err := Open(dir, svc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	o.SetDeadLetters(store, 2)
+
+	o.TriggerEvent("registry:dockerhub:team:app:push", newEvent("latest"))
+	o.dispatch()
+	if o.Pending() != 1 {
+		t.Fatalf("Pending() after 1 attempt = %d, want 1", o.Pending())
+	}
+	o.dispatch()
+	if o.Pending() != 0 {
+		t.Fatalf("Pending() after 2 attempts = %d, want 0", o.Pending())
+	}
+	letters, err := store.List(&deadletter.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].Attempts != 2 || letters[0].EventURI != "registry:dockerhub:team:app:push" {
+		t.Errorf("dead letters = %+v", letters)
+	}
+}
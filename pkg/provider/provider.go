@@ -0,0 +1,419 @@
+package provider
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/coalesce"
+	"github.com/codefresh-io/nomios/pkg/dedup"
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/oci"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+type (
+	// Provider webhook event provider (registry, helm repository, etc)
+	Provider interface {
+		// Name provider name, used in event URI and webhook route (dockerhub, quay, ...)
+		Name() string
+		// EventType event type, used in event URI and webhook route (registry, helm)
+		EventType() string
+		// ParsePayload parse webhook request into normalized events; no events means nothing to trigger
+		ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error)
+		// EventURI build event URI for normalized event
+		EventURI(event *hermes.NormalizedEvent, account string) string
+		// URIRule event URI validation rule
+		URIRule() eventuri.Rule
+		// Describe human readable provider name and webhook settings link for event info
+		Describe(uri *eventuri.URI) Description
+	}
+
+	// Configurable provider with its own command line flags
+	Configurable interface {
+		// Flags provider command line flags
+		Flags() []cli.Flag
+		// Configure configure provider from command line context
+		Configure(c *cli.Context) error
+	}
+
+	// Enricher adds variables to parsed events (querying registry, for example), before they are triggered;
+	// webhook endpoint query may tune enrichment
+	Enricher interface {
+		Enrich(event *hermes.NormalizedEvent, query url.Values) error
+	}
+
+	// Identifier provider with its own event identity, used to suppress duplicate events; by default,
+	// event identity is tag and digest
+	Identifier interface {
+		// EventID event identity; empty if event cannot be identified
+		EventID(event *hermes.NormalizedEvent) string
+	}
+
+	// AuthError webhook request authentication failure
+	AuthError struct {
+		Reason string
+	}
+
+	// Description provider description, used to construct event info
+	Description struct {
+		// Title human readable provider name
+		Title string
+		// SettingsLink link to webhook settings page or documentation
+		SettingsLink string
+		// Help provider specific help text (optional)
+		Help string
+		// Params extra webhook endpoint query parameters (optional)
+		Params url.Values
+	}
+)
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Provider)
+	enrichers []Enricher
+	dedups    *dedup.Cache
+	// coalescers of all webhook handlers
+	coalescers []*coalesce.Coalescer
+	// enrichTimeout total enrichment time of webhook request
+	enrichTimeout = DefaultEnrichTimeout
+)
+
+// DefaultEnrichTimeout default total enrichment time of webhook request, keeps webhook response within
+// registry webhook timeouts
+const DefaultEnrichTimeout = 3 * time.Second
+
+func key(eventType, name string) string {
+	return eventType + ":" + name
+}
+
+// Register make provider and its event URI rule available by event type and name; panics if registered twice
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p == nil {
+		panic("provider: Register provider is nil")
+	}
+	k := key(p.EventType(), p.Name())
+	if _, dup := providers[k]; dup {
+		panic("provider: Register called twice for provider " + k)
+	}
+	providers[k] = p
+	eventuri.RegisterRule(p.EventType(), p.Name(), p.URIRule())
+}
+
+// Lookup find registered provider by event type and name
+func Lookup(eventType, name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[key(eventType, name)]
+	return p, ok
+}
+
+// Providers get all registered providers, sorted by event type and name
+func Providers() []Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+	keys := make([]string, 0, len(providers))
+	for k := range providers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]Provider, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, providers[k])
+	}
+	return list
+}
+
+// Flags get command line flags of all configurable providers
+func Flags() []cli.Flag {
+	var flags []cli.Flag
+	for _, p := range Providers() {
+		if cp, ok := p.(Configurable); ok {
+			flags = append(flags, cp.Flags()...)
+		}
+	}
+	return flags
+}
+
+// Configure configure all configurable providers from command line context
+func Configure(c *cli.Context) error {
+	for _, p := range Providers() {
+		if cp, ok := p.(Configurable); ok {
+			if err := cp.Configure(c); err != nil {
+				return fmt.Errorf("failed to configure %s provider: %v", key(p.EventType(), p.Name()), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *AuthError) Error() string {
+	return "unauthorized webhook request: " + e.Reason
+}
+
+// RequestSecret get webhook secret from "secret" query parameter or, if missing, from request header; "Bearer " prefix is removed
+func RequestSecret(c *gin.Context, header string) string {
+	if secret := c.Query("secret"); secret != "" {
+		return secret
+	}
+	return strings.TrimPrefix(c.Request.Header.Get(header), "Bearer ")
+}
+
+// NewCorrelationID generate random id, shared by events created from the same webhook request
+func NewCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.WithError(err).Error("Failed to generate correlation id")
+	}
+	return hex.EncodeToString(b)
+}
+
+// Path webhook route path for provider: /nomios/{name} for registries and /nomios/{type}/{name} otherwise
+func Path(p Provider) string {
+	if p.EventType() == "registry" {
+		return fmt.Sprintf("/nomios/%s", p.Name())
+	}
+	return fmt.Sprintf("/nomios/%s/%s", p.EventType(), p.Name())
+}
+
+// NewHandler create webhook handler: parse payload and trigger Hermes event for each normalized event
+func NewHandler(p Provider, svc hermes.Service) gin.HandlerFunc {
+	// endpoints with "coalesce" query parameter share provider coalescer
+	coalescer := coalesce.New(svc, forget)
+	mu.Lock()
+	coalescers = append(coalescers, coalescer)
+	mu.Unlock()
+	return func(c *gin.Context) {
+		log.WithField("provider", key(p.EventType(), p.Name())).Debug("Got webhook event")
+		events, err := p.ParsePayload(c)
+		if _, ok := err.(*AuthError); ok {
+			log.WithError(err).Error("Failed to authenticate webhook request")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to parse webhook payload")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// validate endpoint query parameters, before enrichment queries registry
+		// endpoint may opt in to non-image artifacts with "artifact_kind" query parameter
+		kinds, err := oci.ParseKinds(c.Query("artifact_kind"))
+		if err != nil {
+			log.WithError(err).Error("Failed to parse artifact kinds")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// endpoint may coalesce bursty events with "coalesce" window query parameter
+		window, err := coalesceWindow(c.Query("coalesce"))
+		if err != nil {
+			log.WithError(err).Error("Failed to parse coalescing window")
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		enrich(events, c.Request.URL.Query())
+		// trigger all events, even if some fail: registry retry re-sends the whole payload
+		var errs []string
+		for _, event := range events {
+			if !acceptArtifact(event, kinds) {
+				log.WithField("artifact-kind", event.Variables["artifact_kind"]).Debug("Skip artifact event")
+				continue
+			}
+			// get secret from URL query, unless provider got it from the request
+			if event.Secret == "" {
+				event.Secret = c.Query("secret")
+			}
+			eventURI := p.EventURI(event, c.Query("account"))
+			dedupKey := eventKey(p, eventURI, event)
+			if !reserve(dedupKey) {
+				log.WithFields(log.Fields{
+					"event-uri": eventURI,
+					"key":       dedupKey,
+				}).Info("Skip duplicate event")
+				continue
+			}
+			if window > 0 {
+				coalescer.Add(eventURI, event, dedupKey, window)
+				continue
+			}
+			log.WithField("event-uri", eventURI).Debug("Triggering event")
+			// invoke trigger
+			if err = svc.TriggerEvent(eventURI, event); err != nil {
+				// let webhook retry through
+				forget(dedupKey)
+				log.WithError(err).WithField("event-uri", eventURI).Error("Failed to trigger event pipelines")
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": strings.Join(errs, "; ")})
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// Flush trigger events, buffered in coalescing windows of all webhook handlers; call it on shutdown
+func Flush() {
+	mu.RLock()
+	list := append([]*coalesce.Coalescer(nil), coalescers...)
+	mu.RUnlock()
+	for _, c := range list {
+		c.Flush()
+	}
+}
+
+// parse coalescing window duration; no coalescing if empty
+func coalesceWindow(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 || window > coalesce.MaxWindow {
+		return 0, fmt.Errorf("bad coalescing window '%s': expected duration up to %v", value, coalesce.MaxWindow)
+	}
+	return window, nil
+}
+
+// AddEnricher add event enricher, applied by all webhook handlers
+func AddEnricher(e Enricher) {
+	mu.Lock()
+	defer mu.Unlock()
+	enrichers = append(enrichers, e)
+}
+
+// SetEnrichTimeout limit total enrichment time of webhook request; events, not enriched in time, are
+// triggered as is; 0 means no limit
+func SetEnrichTimeout(timeout time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	enrichTimeout = timeout
+}
+
+// SetDedup suppress duplicate events, triggered within dedup cache TTL window; nil disables suppression
+func SetDedup(cache *dedup.Cache) {
+	mu.Lock()
+	defer mu.Unlock()
+	dedups = cache
+}
+
+// event dedup key: event URI and provider event identity (tag and digest by default); empty if
+// event cannot be identified
+func eventKey(p Provider, eventURI string, event *hermes.NormalizedEvent) string {
+	var id string
+	if i, ok := p.(Identifier); ok {
+		id = i.EventID(event)
+	} else if digest := event.Variables["digest"]; digest != "" {
+		id = event.Variables["tag"] + "@" + digest
+	}
+	if id == "" {
+		return ""
+	}
+	return eventURI + "#" + id
+}
+
+// reserve record event key in dedup cache; false for duplicate event
+func reserve(key string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if dedups == nil || key == "" {
+		return true
+	}
+	return dedups.Reserve(key)
+}
+
+// forget remove event key from dedup cache
+func forget(key string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if dedups != nil && key != "" {
+		dedups.Forget(key)
+	}
+}
+
+// apply enrichers to events within enrichment timeout; enrichment failure is logged and does not block
+// event, events not enriched in time are triggered as is
+func enrich(events []*hermes.NormalizedEvent, query url.Values) {
+	// do not hold lock during enrichment (registry requests)
+	mu.RLock()
+	list := append([]Enricher(nil), enrichers...)
+	timeout := enrichTimeout
+	mu.RUnlock()
+	if len(list) == 0 {
+		return
+	}
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for i, event := range events {
+		// enrich event copy: late enrichment must not change event, that is triggered already
+		enriched := copyEvent(event)
+		done := make(chan struct{})
+		go func() {
+			enrichEvent(list, enriched, query)
+			close(done)
+		}()
+		select {
+		case <-done:
+			*event = *enriched
+		case <-deadline:
+			log.WithFields(log.Fields{
+				"timeout": timeout,
+				"events":  len(events) - i,
+			}).Warn("Event enrichment timed out, triggering events as is")
+			return
+		}
+	}
+}
+
+func copyEvent(event *hermes.NormalizedEvent) *hermes.NormalizedEvent {
+	c := *event
+	c.Variables = make(map[string]string, len(event.Variables))
+	for k, v := range event.Variables {
+		c.Variables[k] = v
+	}
+	return &c
+}
+
+// apply enrichers to event
+func enrichEvent(list []Enricher, event *hermes.NormalizedEvent, query url.Values) {
+	for _, e := range list {
+		if err := e.Enrich(event, query); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"namespace": event.Variables["namespace"],
+				"name":      event.Variables["name"],
+				"tag":       event.Variables["tag"],
+			}).Warn("Failed to enrich event")
+		}
+	}
+}
+
+// set "artifact_kind" variable of registry and helm event, unless provider did it, and check
+// it's accepted; other event types are always accepted
+func acceptArtifact(event *hermes.NormalizedEvent, kinds map[string]bool) bool {
+	if event.Variables["artifact_kind"] == "" {
+		switch event.Variables["type"] {
+		case "registry":
+			event.Variables["artifact_kind"] = oci.Classify(event.Variables["media_type"], event.Variables["artifact_type"], event.Variables["tag"])
+		case "helm":
+			event.Variables["artifact_kind"] = oci.KindHelmChart
+		default:
+			return true
+		}
+	}
+	return kinds[event.Variables["artifact_kind"]]
+}
@@ -0,0 +1,503 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/dedup"
+	"github.com/codefresh-io/nomios/pkg/eventuri"
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+type HermesMock struct {
+	mock.Mock
+}
+
+func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent) error {
+	args := m.Called(eventURI, event)
+	return args.Error(0)
+
+}
+
+type fakeProvider struct {
+	eventType string
+	events    []*hermes.NormalizedEvent
+	err       error
+}
+
+func (f *fakeProvider) Name() string      { return "fake" }
+func (f *fakeProvider) EventType() string { return f.eventType }
+func (f *fakeProvider) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	return f.events, f.err
+}
+func (f *fakeProvider) EventURI(event *hermes.NormalizedEvent, account string) string {
+	return f.eventType + ":fake:" + event.Variables["name"] + ":push:" + account
+}
+func (f *fakeProvider) URIRule() eventuri.Rule {
+	return eventuri.Rule{Actions: []string{"push"}}
+}
+func (f *fakeProvider) Describe(uri *eventuri.URI) Description {
+	return Description{Title: "Fake"}
+}
+
+func TestRegister(t *testing.T) {
+	p := &fakeProvider{eventType: "registry"}
+	Register(p)
+	defer func() {
+		delete(providers, "registry:fake")
+		if r := recover(); r == nil {
+			t.Error("Register() expected panic on duplicate provider")
+		}
+	}()
+	if got, ok := Lookup("registry", "fake"); !ok || got != p {
+		t.Errorf("Lookup() = %v, %v, want %v", got, ok, p)
+	}
+	if _, ok := Lookup("helm", "fake"); ok {
+		t.Error("Lookup() found unexpected helm provider")
+	}
+	if list := Providers(); len(list) != 1 || list[0] != p {
+		t.Errorf("Providers() = %v", list)
+	}
+	Register(p)
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		eventType string
+		want      string
+	}{
+		{"registry", "/nomios/fake"},
+		{"helm", "/nomios/helm/fake"},
+	}
+	for _, tt := range tests {
+		if got := Path(&fakeProvider{eventType: tt.eventType}); got != tt.want {
+			t.Errorf("Path() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	first := hermes.NewNormalizedEvent()
+	first.Variables["name"] = "first"
+	second := hermes.NewNormalizedEvent()
+	second.Variables["name"] = "second"
+
+	tests := []struct {
+		name     string
+		provider *fakeProvider
+		hermes   error
+		want     int
+	}{
+		{"all events", &fakeProvider{eventType: "registry", events: []*hermes.NormalizedEvent{first, second}}, nil, http.StatusOK},
+		{"no events", &fakeProvider{eventType: "registry"}, nil, http.StatusOK},
+		{"bad payload", &fakeProvider{eventType: "registry", err: errors.New("bad payload")}, nil, http.StatusBadRequest},
+		{"unauthorized", &fakeProvider{eventType: "registry", err: &AuthError{"bad token"}}, nil, http.StatusUnauthorized},
+		{"hermes failure", &fakeProvider{eventType: "registry", events: []*hermes.NormalizedEvent{first}}, errors.New("failed"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			var err error
+			c.Request, err = http.NewRequest("POST", "/fake?secret=SECRET&account=cb1e73c5215b", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hermesMock := new(HermesMock)
+			for _, event := range tt.provider.events {
+				hermesMock.On("TriggerEvent", "registry:fake:"+event.Variables["name"]+":push:cb1e73c5215b", event).Return(tt.hermes)
+			}
+
+			router.POST("/fake", NewHandler(tt.provider, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("NewHandler() status = %v, want %v", rr.Code, tt.want)
+			}
+			for _, event := range tt.provider.events {
+				if event.Secret != "SECRET" {
+					t.Errorf("NewHandler() secret = %v, want SECRET", event.Secret)
+				}
+			}
+			if tt.hermes == nil {
+				hermesMock.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestRequestSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		want   string
+	}{
+		{"query secret", "/fake?secret=SECRET", "Bearer HEADER", "SECRET"},
+		{"bearer header", "/fake", "Bearer HEADER", "HEADER"},
+		{"raw header", "/fake", "HEADER", "HEADER"},
+		{"no secret", "/fake", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			var err error
+			c.Request, err = http.NewRequest("POST", tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Request.Header.Set("Authorization", tt.header)
+			if got := RequestSecret(c, "Authorization"); got != tt.want {
+				t.Errorf("RequestSecret() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHandlerArtifactKind(t *testing.T) {
+	signature := "sha256-8a9e9863dbb6e10edb5adfe917c00da84e1700fa76e7ed02476aa6e6fb8ee0d8.sig"
+	tests := []struct {
+		name    string
+		query   string
+		tag     string
+		trigger bool
+		want    int
+	}{
+		{"image by default", "", "1.0.0", true, http.StatusOK},
+		{"signature skipped by default", "", signature, false, http.StatusOK},
+		{"signature opt in", "&artifact_kind=signature", signature, true, http.StatusOK},
+		{"image opt out", "&artifact_kind=signature", "1.0.0", false, http.StatusOK},
+		{"all kinds", "&artifact_kind=all", signature, true, http.StatusOK},
+		{"unknown kind", "&artifact_kind=binary", "1.0.0", false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := hermes.NewNormalizedEvent()
+			event.Variables["name"] = "app"
+			event.Variables["tag"] = tt.tag
+			event.Variables["type"] = "registry"
+
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			var err error
+			c.Request, err = http.NewRequest("POST", "/fake?secret=SECRET"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hermesMock := new(HermesMock)
+			hermesMock.On("TriggerEvent", "registry:fake:app:push:", event).Return(nil)
+
+			p := &fakeProvider{eventType: "registry", events: []*hermes.NormalizedEvent{event}}
+			router.POST("/fake", NewHandler(p, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("NewHandler() status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.trigger {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+type fakeEnricher struct {
+	err error
+}
+
+func (f *fakeEnricher) Enrich(event *hermes.NormalizedEvent, query url.Values) error {
+	event.Variables["digest"] = "sha256:enriched"
+	return f.err
+}
+
+func TestNewHandlerEnricher(t *testing.T) {
+	defer func() { enrichers = nil }()
+	AddEnricher(&fakeEnricher{})
+	AddEnricher(&fakeEnricher{err: errors.New("registry is down")})
+
+	event := hermes.NewNormalizedEvent()
+	event.Variables["name"] = "app"
+
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+	var err error
+	c.Request, err = http.NewRequest("POST", "/fake?secret=SECRET", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hermesMock := new(HermesMock)
+	hermesMock.On("TriggerEvent", "registry:fake:app:push:", event).Return(nil)
+
+	router.POST("/fake", NewHandler(&fakeProvider{eventType: "registry", events: []*hermes.NormalizedEvent{event}}, hermesMock))
+	router.HandleContext(c)
+
+	// enrichment failure does not block event
+	if rr.Code != http.StatusOK {
+		t.Errorf("NewHandler() status = %v, want %v", rr.Code, http.StatusOK)
+	}
+	hermesMock.AssertExpectations(t)
+	if event.Variables["digest"] != "sha256:enriched" {
+		t.Errorf("NewHandler() digest = %v, want sha256:enriched", event.Variables["digest"])
+	}
+}
+
+// enricher, blocked until released
+type slowEnricher struct {
+	release chan struct{}
+}
+
+func (s *slowEnricher) Enrich(event *hermes.NormalizedEvent, query url.Values) error {
+	<-s.release
+	event.Variables["digest"] = "sha256:late"
+	return nil
+}
+
+func TestNewHandlerEnrichTimeout(t *testing.T) {
+	slow := &slowEnricher{release: make(chan struct{})}
+	defer func() {
+		close(slow.release)
+		enrichers = nil
+		SetEnrichTimeout(DefaultEnrichTimeout)
+	}()
+	AddEnricher(slow)
+	SetEnrichTimeout(50 * time.Millisecond)
+
+	event := hermes.NewNormalizedEvent()
+	event.Variables["name"] = "app"
+
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+	var err error
+	c.Request, err = http.NewRequest("POST", "/fake?secret=SECRET", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hermesMock := new(HermesMock)
+	hermesMock.On("TriggerEvent", "registry:fake:app:push:", mock.MatchedBy(func(e *hermes.NormalizedEvent) bool {
+		return e.Variables["digest"] == ""
+	})).Return(nil)
+
+	router.POST("/fake", NewHandler(&fakeProvider{eventType: "registry", events: []*hermes.NormalizedEvent{event}}, hermesMock))
+	start := time.Now()
+	router.HandleContext(c)
+
+	// event is triggered as is, without waiting for enrichment
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("NewHandler() took %v, want enrichment timeout", d)
+	}
+	if rr.Code != http.StatusOK {
+		t.Errorf("NewHandler() status = %v, want %v", rr.Code, http.StatusOK)
+	}
+	hermesMock.AssertExpectations(t)
+}
+
+func TestNewHandlerDedup(t *testing.T) {
+	defer SetDedup(nil)
+	SetDedup(dedup.New(time.Minute))
+
+	newEvent := func(tag, digest string) *hermes.NormalizedEvent {
+		event := hermes.NewNormalizedEvent()
+		event.Variables["name"] = "app"
+		event.Variables["tag"] = tag
+		event.Variables["digest"] = digest
+		return event
+	}
+	tests := []struct {
+		name    string
+		event   *hermes.NormalizedEvent
+		hermes  error
+		trigger bool
+	}{
+		{"first push", newEvent("1.0", "sha256:a"), nil, true},
+		{"webhook retry", newEvent("1.0", "sha256:a"), nil, false},
+		{"new digest", newEvent("1.0", "sha256:b"), nil, true},
+		{"other tag", newEvent("1.1", "sha256:a"), nil, true},
+		{"no digest", newEvent("1.2", ""), nil, true},
+		{"no digest again", newEvent("1.2", ""), nil, true},
+		{"failed trigger", newEvent("2.0", "sha256:c"), errors.New("hermes is down"), true},
+		{"failed trigger retry", newEvent("2.0", "sha256:c"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			var err error
+			c.Request, err = http.NewRequest("POST", "/fake?secret=SECRET", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hermesMock := new(HermesMock)
+			hermesMock.On("TriggerEvent", "registry:fake:app:push:", tt.event).Return(tt.hermes)
+
+			router.POST("/fake", NewHandler(&fakeProvider{eventType: "registry", events: []*hermes.NormalizedEvent{tt.event}}, hermesMock))
+			router.HandleContext(c)
+
+			if tt.trigger {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+				if rr.Code != http.StatusOK {
+					t.Errorf("NewHandler() status = %v, want %v", rr.Code, http.StatusOK)
+				}
+			}
+		})
+	}
+}
+
+type identifiedProvider struct {
+	fakeProvider
+}
+
+func (p *identifiedProvider) EventID(event *hermes.NormalizedEvent) string {
+	return event.Variables["event_id"]
+}
+
+func TestEventKey(t *testing.T) {
+	event := hermes.NewNormalizedEvent()
+	event.Variables["tag"] = "1.0"
+	event.Variables["digest"] = "sha256:a"
+	event.Variables["event_id"] = "42"
+	uri := "registry:fake:app:push:"
+
+	if key := eventKey(&fakeProvider{}, uri, event); key != uri+"#1.0@sha256:a" {
+		t.Errorf("eventKey() = %v", key)
+	}
+	if key := eventKey(&identifiedProvider{}, uri, event); key != uri+"#42" {
+		t.Errorf("eventKey() identifier = %v", key)
+	}
+	delete(event.Variables, "event_id")
+	if key := eventKey(&identifiedProvider{}, uri, event); key != "" {
+		t.Errorf("eventKey() no identity = %v", key)
+	}
+}
+
+func TestNewHandlerCoalesce(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"coalesce", "&coalesce=20ms", http.StatusOK},
+		{"bad window", "&coalesce=soon", http.StatusBadRequest},
+		{"too long window", "&coalesce=24h", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []*hermes.NormalizedEvent
+			for _, tag := range []string{"1.0", "1.1", "latest"} {
+				event := hermes.NewNormalizedEvent()
+				event.Variables["name"] = "app"
+				event.Variables["tag"] = tag
+				events = append(events, event)
+			}
+
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			var err error
+			c.Request, err = http.NewRequest("POST", "/fake?secret=SECRET"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			triggered := make(chan *hermes.NormalizedEvent, 3)
+			hermesMock := new(HermesMock)
+			hermesMock.On("TriggerEvent", "registry:fake:app:push:", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				triggered <- args.Get(1).(*hermes.NormalizedEvent)
+			})
+
+			router.POST("/fake", NewHandler(&fakeProvider{eventType: "registry", events: events}, hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("NewHandler() status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+				return
+			}
+			select {
+			case event := <-triggered:
+				if event.Variables["tags"] != "1.0,1.1,latest" || event.Variables["tag"] != "latest" {
+					t.Errorf("coalesced event variables = %v", event.Variables)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("coalesced event is not triggered")
+			}
+			time.Sleep(30 * time.Millisecond)
+			hermesMock.AssertNumberOfCalls(t, "TriggerEvent", 1)
+		})
+	}
+}
+
+func TestNewHandlerMultipleEvents(t *testing.T) {
+	var events []*hermes.NormalizedEvent
+	for _, name := range []string{"app", "api", "web"} {
+		event := hermes.NewNormalizedEvent()
+		event.Variables["name"] = name
+		events = append(events, event)
+	}
+
+	rr := httptest.NewRecorder()
+	c, router := gin.CreateTestContext(rr)
+	var err error
+	c.Request, err = http.NewRequest("POST", "/fake?secret=SECRET", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// failed event does not stop other events
+	hermesMock := new(HermesMock)
+	hermesMock.On("TriggerEvent", "registry:fake:app:push:", events[0]).Return(nil)
+	hermesMock.On("TriggerEvent", "registry:fake:api:push:", events[1]).Return(errors.New("hermes is down"))
+	hermesMock.On("TriggerEvent", "registry:fake:web:push:", events[2]).Return(nil)
+
+	router.POST("/fake", NewHandler(&fakeProvider{eventType: "registry", events: events}, hermesMock))
+	router.HandleContext(c)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("NewHandler() status = %v, want %v", rr.Code, http.StatusBadRequest)
+	}
+	hermesMock.AssertExpectations(t)
+	hermesMock.AssertNumberOfCalls(t, "TriggerEvent", 3)
+}
+
+func TestNewHandlerValidateBeforeEnrich(t *testing.T) {
+	defer func() { enrichers = nil }()
+	AddEnricher(&fakeEnricher{})
+
+	for _, query := range []string{"&artifact_kind=binary", "&coalesce=soon"} {
+		event := hermes.NewNormalizedEvent()
+		event.Variables["name"] = "app"
+
+		rr := httptest.NewRecorder()
+		c, router := gin.CreateTestContext(rr)
+		var err error
+		c.Request, err = http.NewRequest("POST", "/fake?secret=SECRET"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hermesMock := new(HermesMock)
+		router.POST("/fake", NewHandler(&fakeProvider{eventType: "registry", events: []*hermes.NormalizedEvent{event}}, hermesMock))
+		router.HandleContext(c)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("NewHandler(%s) status = %v, want %v", query, rr.Code, http.StatusBadRequest)
+		}
+		if event.Variables["digest"] != "" {
+			t.Errorf("NewHandler(%s) enriched event with bad query", query)
+		}
+	}
+}
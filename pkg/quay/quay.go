@@ -3,18 +3,18 @@ package quay
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/codefresh-io/nomios/pkg/eventuri"
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
-	"net/http"
 )
 
+// Quay Quay webhook provider
 type Quay struct {
-	hermesSvc hermes.Service
-}
-
-func NewQuay(svc hermes.Service) *Quay {
-	return &Quay{svc}
 }
 
 type webhookPayload struct {
@@ -25,61 +25,259 @@ type webhookPayload struct {
 	PrunedImageCount int64    `json:"pruned_image_count"`
 	Homepage         string   `json:"homepage"`
 	UpdatedTags      []string `json:"updated_tags"`
+	// build notifications
+	BuildID         string           `json:"build_id,omitempty"`
+	TriggerKind     string           `json:"trigger_kind,omitempty"`
+	TriggerID       string           `json:"trigger_id,omitempty"`
+	DockerTags      []string         `json:"docker_tags,omitempty"`
+	TriggerMetadata *triggerMetadata `json:"trigger_metadata,omitempty"`
+	ErrorMessage    string           `json:"error_message,omitempty"`
+	// vulnerability_found notification
+	Tags          []string       `json:"tags,omitempty"`
+	Vulnerability *vulnerability `json:"vulnerability,omitempty"`
+}
+
+type vulnerability struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	Link        string `json:"link,omitempty"`
+	Priority    string `json:"priority"`
+	HasFix      bool   `json:"has_fix"`
+}
+
+type triggerMetadata struct {
+	DefaultBranch string `json:"default_branch,omitempty"`
+	Commit        string `json:"commit,omitempty"`
+	Ref           string `json:"ref,omitempty"`
+	GitURL        string `json:"git_url,omitempty"`
+}
+
+// Quay notification events, set with "event" webhook query parameter; repository push is the default
+// and vulnerability_found is detected by payload
+var (
+	pushAction          = "push"
+	vulnerabilityAction = "vulnerability"
+	buildActions        = []string{"build_queued", "build_start", "build_success", "build_failure", "build_cancelled"}
+)
+
+// Quay vulnerability priorities, from lowest to highest
+var priorities = []string{"Unknown", "Negligible", "Low", "Medium", "High", "Critical", "Defcon1"}
+
+// correlation id generator, shared by events of the same push
+var newCorrelationID = provider.NewCorrelationID
+
+func init() {
+	provider.Register(NewQuay())
+}
+
+// NewQuay new quay provider
+func NewQuay() *Quay {
+	return &Quay{}
 }
 
-func constructEventURI(payload *webhookPayload, account string) string {
-	uri := fmt.Sprintf("registry:quay:%s:%s:push", payload.Namespace, payload.Name)
-	if account != "" {
-		uri = fmt.Sprintf("%s:%s", uri, account)
+// Name provider name
+func (q *Quay) Name() string {
+	return "quay"
+}
+
+// EventType provider event type
+func (q *Quay) EventType() string {
+	return "registry"
+}
+
+// EventURI construct Quay event URI
+func (q *Quay) EventURI(event *hermes.NormalizedEvent, account string) string {
+	uri := eventuri.URI{
+		Type:      "registry",
+		Provider:  "quay",
+		Namespace: event.Variables["namespace"],
+		Name:      event.Variables["name"],
+		Action:    event.Variables["event"],
+		Account:   account,
+	}
+	return uri.String()
+}
+
+// URIRule event URI validation rule
+func (q *Quay) URIRule() eventuri.Rule {
+	return eventuri.Rule{
+		Actions: append([]string{pushAction, vulnerabilityAction}, buildActions...),
 	}
-	return uri
 }
 
-func (q *Quay) HandleWebhook(c *gin.Context) {
+// Describe Quay event info; notification event is passed as "event" webhook query parameter
+func (q *Quay) Describe(uri *eventuri.URI) provider.Description {
+	desc := provider.Description{
+		Title:        "Quay",
+		SettingsLink: fmt.Sprintf("https://quay.io/repository/%s/%s?tab=settings", uri.Namespace, uri.Name),
+	}
+	switch uri.Action {
+	case pushAction:
+	case vulnerabilityAction:
+		desc.Help = "Quay vulnerability_found notifications fire when security scanner finds a vulnerability in your repository. Add 'min_severity' query parameter (Low, Medium, High, Critical, Defcon1) to ignore less severe vulnerabilities."
+	default:
+		desc.Help = fmt.Sprintf("Quay %s notifications fire when repository build state changes. Add a separate Quay notification for every build event.", uri.Action)
+		desc.Params = url.Values{"event": []string{uri.Action}}
+	}
+	return desc
+}
+
+// ParsePayload parse Quay webhook payload
+func (q *Quay) ParsePayload(c *gin.Context) ([]*hermes.NormalizedEvent, error) {
+	action := c.DefaultQuery("event", pushAction)
+	if action == "vulnerability_found" {
+		action = vulnerabilityAction
+	}
+	if action != pushAction && action != vulnerabilityAction && !isBuildAction(action) {
+		return nil, fmt.Errorf("unsupported Quay event: %s", action)
+	}
+
 	payload := webhookPayload{}
 	if err := c.BindJSON(&payload); err != nil {
-		fmt.Println(err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		log.WithError(err).Error("Failed to bind payload JSON to expected structure")
+		return nil, err
+	}
+	if payload.Vulnerability != nil {
+		action = vulnerabilityAction
 	}
-	fmt.Println("Name: " + payload.Name)
-	fmt.Println("Namespace: " + payload.Namespace)
+	log.WithFields(log.Fields{
+		"namespace": payload.Namespace,
+		"name":      payload.Name,
+		"event":     action,
+	}).Debug("Got Quay webhook event")
 
-	event := hermes.NewNormalizedEvent()
-	eventURI := constructEventURI(&payload, c.Query("account"))
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		log.WithError(err).Error("Failed to covert webhook payload structure to JSON")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
+
+	if action == vulnerabilityAction {
+		return vulnerabilityEvents(c.Query("min_severity"), &payload, string(payloadJSON))
+	}
+	if action != pushAction {
+		return []*hermes.NormalizedEvent{buildEvent(action, &payload, string(payloadJSON))}, nil
+	}
+
+	// event per updated tag (default) or single event with all tags ("tags=list" query parameter)
+	listMode := c.Query("tags") == "list"
+	groups := [][]string{payload.UpdatedTags}
+	if !listMode && len(payload.UpdatedTags) > 1 {
+		groups = make([][]string, 0, len(payload.UpdatedTags))
+		for _, tag := range payload.UpdatedTags {
+			groups = append(groups, []string{tag})
+		}
+	}
+	correlationID := newCorrelationID()
+
+	var events []*hermes.NormalizedEvent
+	for _, tags := range groups {
+		event := hermes.NewNormalizedEvent()
+		// keep original JSON
+		event.Original = string(payloadJSON)
+
+		// get image push details
+		event.Variables["namespace"] = payload.Namespace
+		event.Variables["name"] = payload.Name
+		if len(tags) > 0 {
+			event.Variables["tag"] = tags[0]
+		}
+		if listMode {
+			event.Variables["tags"] = strings.Join(tags, ",")
+		}
+		event.Variables["correlation_id"] = correlationID
+		event.Variables["event"] = "push"
+		event.Variables["url"] = payload.Homepage
+		event.Variables["provider"] = "quay"
+		event.Variables["type"] = "registry"
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// build notification event
+func buildEvent(action string, payload *webhookPayload, original string) *hermes.NormalizedEvent {
+	event := hermes.NewNormalizedEvent()
 	// keep original JSON
-	event.Original = string(payloadJSON)
+	event.Original = original
 
-	// get image push details
+	// get build details
 	event.Variables["namespace"] = payload.Namespace
 	event.Variables["name"] = payload.Name
-	//TODO : handle array of tags
-	if payload.UpdatedTags != nil && len(payload.UpdatedTags) > 0 {
-		event.Variables["tag"] = payload.UpdatedTags[0]
+	if len(payload.DockerTags) > 0 {
+		event.Variables["tag"] = payload.DockerTags[0]
 	}
-	event.Variables["event"] = "push"
+	event.Variables["tags"] = strings.Join(payload.DockerTags, ",")
+	event.Variables["build_id"] = payload.BuildID
+	event.Variables["trigger_kind"] = payload.TriggerKind
+	if payload.TriggerMetadata != nil {
+		event.Variables["commit"] = payload.TriggerMetadata.Commit
+		event.Variables["ref"] = payload.TriggerMetadata.Ref
+	}
+	if payload.ErrorMessage != "" {
+		event.Variables["error_message"] = payload.ErrorMessage
+	}
+	event.Variables["event"] = action
 	event.Variables["url"] = payload.Homepage
 	event.Variables["provider"] = "quay"
 	event.Variables["type"] = "registry"
+	return event
+}
 
-	// get secret from URL query
-	event.Secret = c.Query("secret")
+// vulnerability_found notification event; no events if vulnerability priority is below minSeverity
+func vulnerabilityEvents(minSeverity string, payload *webhookPayload, original string) ([]*hermes.NormalizedEvent, error) {
+	if payload.Vulnerability == nil {
+		return nil, fmt.Errorf("missing vulnerability in Quay vulnerability_found notification")
+	}
+	if minSeverity != "" {
+		min := priorityRank(minSeverity)
+		if min == -1 {
+			return nil, fmt.Errorf("unknown Quay vulnerability severity: %s", minSeverity)
+		}
+		if priorityRank(payload.Vulnerability.Priority) < min {
+			log.Debug(fmt.Sprintf("Skip %s vulnerability %s", payload.Vulnerability.Priority, payload.Vulnerability.ID))
+			return nil, nil
+		}
+	}
 
-	log.Debug("Event url " + eventURI)
+	event := hermes.NewNormalizedEvent()
+	// keep original JSON
+	event.Original = original
 
-	// invoke trigger
-	err = q.hermesSvc.TriggerEvent(eventURI, event)
-	if err != nil {
-		log.WithError(err).Error("Failed to trigger event pipelines")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	// get vulnerability details
+	event.Variables["namespace"] = payload.Namespace
+	event.Variables["name"] = payload.Name
+	if len(payload.Tags) > 0 {
+		event.Variables["tag"] = payload.Tags[0]
 	}
+	event.Variables["tags"] = strings.Join(payload.Tags, ",")
+	event.Variables["cve"] = payload.Vulnerability.ID
+	event.Variables["severity"] = payload.Vulnerability.Priority
+	event.Variables["link"] = payload.Vulnerability.Link
+	event.Variables["has_fix"] = fmt.Sprint(payload.Vulnerability.HasFix)
+	event.Variables["event"] = vulnerabilityAction
+	event.Variables["url"] = payload.Homepage
+	event.Variables["provider"] = "quay"
+	event.Variables["type"] = "registry"
+	return []*hermes.NormalizedEvent{event}, nil
+}
 
-	c.Status(http.StatusOK)
+// priority rank, case insensitive; -1 for unknown priority
+func priorityRank(priority string) int {
+	for i, p := range priorities {
+		if strings.EqualFold(p, priority) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isBuildAction(action string) bool {
+	for _, a := range buildActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/codefresh-io/nomios/pkg/hermes"
+	"github.com/codefresh-io/nomios/pkg/provider"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/mock"
 	"io/ioutil"
@@ -22,6 +23,10 @@ func (m *HermesMock) TriggerEvent(eventURI string, event *hermes.NormalizedEvent
 
 }
 
+func init() {
+	newCorrelationID = func() string { return "CORRELATION-ID" }
+}
+
 func TestContextBindWithQuery(t *testing.T) {
 	rr := httptest.NewRecorder()
 	c, router := gin.CreateTestContext(rr)
@@ -49,22 +54,234 @@ func TestContextBindWithQuery(t *testing.T) {
 		Original: string(data),
 		Secret:   "SECRET",
 		Variables: map[string]string{
-			"namespace": "namespace",
-			"name":      "name",
-			"tag":       "updated_tags",
-			"event":     "push",
-			"url":       "homepage",
-			"provider":  "quay",
-			"type":      "registry",
+			"namespace":      "namespace",
+			"name":           "name",
+			"tag":            "updated_tags",
+			"correlation_id": "CORRELATION-ID",
+			"event":          "push",
+			"url":            "homepage",
+			"provider":       "quay",
+			"type":           "registry",
+			"artifact_kind":  "image",
 		},
 	}
 	hermesMock.On("TriggerEvent", eventURI, &event).Return(nil)
 
 	// bind quay to hermes API endpoint
-	quay := NewQuay(hermesMock)
-	router.POST("/quay", quay.HandleWebhook)
+	router.POST("/quay", provider.NewHandler(NewQuay(), hermesMock))
 	router.HandleContext(c)
 
 	// assert expectations
 	hermesMock.AssertExpectations(t)
 }
+
+func TestMultipleTags(t *testing.T) {
+	payload := webhookPayload{
+		Name:        "name",
+		Namespace:   "namespace",
+		Homepage:    "homepage",
+		UpdatedTags: []string{"latest", "1.2.3", "sha-abc"},
+	}
+	data, _ := json.Marshal(payload)
+	event := func(vars map[string]string) *hermes.NormalizedEvent {
+		e := hermes.NormalizedEvent{
+			Original: string(data),
+			Secret:   "SECRET",
+			Variables: map[string]string{
+				"namespace":      "namespace",
+				"name":           "name",
+				"correlation_id": "CORRELATION-ID",
+				"event":          "push",
+				"url":            "homepage",
+				"provider":       "quay",
+				"type":           "registry",
+				"artifact_kind":  "image",
+			},
+		}
+		for k, v := range vars {
+			e.Variables[k] = v
+		}
+		return &e
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		events []*hermes.NormalizedEvent
+	}{
+		{
+			name: "event per tag",
+			url:  "/quay?secret=SECRET",
+			events: []*hermes.NormalizedEvent{
+				event(map[string]string{"tag": "latest"}),
+				event(map[string]string{"tag": "1.2.3"}),
+				event(map[string]string{"tag": "sha-abc"}),
+			},
+		},
+		{
+			name: "tags list",
+			url:  "/quay?secret=SECRET&tags=list",
+			events: []*hermes.NormalizedEvent{
+				event(map[string]string{"tag": "latest", "tags": "latest,1.2.3,sha-abc"}),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			var err error
+			c.Request, err = http.NewRequest("POST", tt.url, bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hermesMock := new(HermesMock)
+			for _, e := range tt.events {
+				hermesMock.On("TriggerEvent", "registry:quay:namespace:name:push", e).Return(nil)
+			}
+
+			router.POST("/quay", provider.NewHandler(NewQuay(), hermesMock))
+			router.HandleContext(c)
+
+			hermesMock.AssertExpectations(t)
+			hermesMock.AssertNumberOfCalls(t, "TriggerEvent", len(tt.events))
+		})
+	}
+}
+
+func TestBuildEvents(t *testing.T) {
+	file, err := ioutil.ReadFile("./test_payload_build.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload webhookPayload
+	if err = json.Unmarshal(file, &payload); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(payload)
+
+	tests := []struct {
+		name     string
+		url      string
+		eventURI string
+		want     int
+	}{
+		{"build failure", "/quay?secret=SECRET&event=build_failure", "registry:quay:mynamespace:repository:build_failure", http.StatusOK},
+		{"build success", "/quay?secret=SECRET&event=build_success", "registry:quay:mynamespace:repository:build_success", http.StatusOK},
+		{"unknown event", "/quay?secret=SECRET&event=build_exploded", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", tt.url, bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hermesMock := new(HermesMock)
+			if tt.eventURI != "" {
+				event := hermes.NormalizedEvent{
+					Original: string(data),
+					Secret:   "SECRET",
+					Variables: map[string]string{
+						"namespace":     "mynamespace",
+						"name":          "repository",
+						"tag":           "master",
+						"tags":          "master,latest",
+						"build_id":      "296ec063-5f86-4706-a469-f0a400bf9df2",
+						"trigger_kind":  "github",
+						"commit":        "b7f7d2b948aacbe844ee465122a85a9368b2b735",
+						"ref":           "refs/heads/master",
+						"error_message": "Could not find or parse Dockerfile: unknown instruction: GIT",
+						"event":         c.Request.URL.Query().Get("event"),
+						"url":           "https://quay.io/repository/mynamespace/repository/build/296ec063-5f86-4706-a469-f0a400bf9df2",
+						"provider":      "quay",
+						"type":          "registry",
+						"artifact_kind": "image",
+					},
+				}
+				hermesMock.On("TriggerEvent", tt.eventURI, &event).Return(nil)
+			}
+
+			router.POST("/quay", provider.NewHandler(NewQuay(), hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			hermesMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestVulnerabilityFound(t *testing.T) {
+	file, err := ioutil.ReadFile("./test_payload_vulnerability.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload webhookPayload
+	if err = json.Unmarshal(file, &payload); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(payload)
+
+	tests := []struct {
+		name      string
+		url       string
+		want      int
+		triggered bool
+	}{
+		{"no filter", "/quay?secret=SECRET", http.StatusOK, true},
+		{"explicit event", "/quay?secret=SECRET&event=vulnerability_found", http.StatusOK, true},
+		{"severity above minimum", "/quay?secret=SECRET&min_severity=medium", http.StatusOK, true},
+		{"severity equals minimum", "/quay?secret=SECRET&min_severity=High", http.StatusOK, true},
+		{"severity below minimum", "/quay?secret=SECRET&min_severity=Critical", http.StatusOK, false},
+		{"unknown minimum", "/quay?secret=SECRET&min_severity=Scary", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			c, router := gin.CreateTestContext(rr)
+			c.Request, err = http.NewRequest("POST", tt.url, bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hermesMock := new(HermesMock)
+			event := hermes.NormalizedEvent{
+				Original: string(data),
+				Secret:   "SECRET",
+				Variables: map[string]string{
+					"namespace":     "mynamespace",
+					"name":          "repository",
+					"tag":           "latest",
+					"tags":          "latest,othertag",
+					"cve":           "CVE-2021-3711",
+					"severity":      "High",
+					"link":          "https://nvd.nist.gov/vuln/detail/CVE-2021-3711",
+					"has_fix":       "true",
+					"event":         "vulnerability",
+					"url":           "https://quay.io/repository/mynamespace/repository",
+					"provider":      "quay",
+					"type":          "registry",
+					"artifact_kind": "image",
+				},
+			}
+			hermesMock.On("TriggerEvent", "registry:quay:mynamespace:repository:vulnerability", &event).Return(nil)
+
+			router.POST("/quay", provider.NewHandler(NewQuay(), hermesMock))
+			router.HandleContext(c)
+
+			if rr.Code != tt.want {
+				t.Errorf("status = %v, want %v", rr.Code, tt.want)
+			}
+			if tt.triggered {
+				hermesMock.AssertExpectations(t)
+			} else {
+				hermesMock.AssertNotCalled(t, "TriggerEvent", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
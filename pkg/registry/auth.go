@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// authorize set request Authorization header, answering registry WWW-Authenticate challenge:
+// Basic or Bearer (token server) authentication
+func (c *Client) authorize(repo *Repository, req *http.Request, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if repo.Username == "" {
+			return fmt.Errorf("registry %s requires credentials", repo.URL)
+		}
+		req.SetBasicAuth(repo.Username, repo.Password)
+		return nil
+	case "bearer":
+		token, err := c.token(repo, params)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	return fmt.Errorf("unsupported registry authentication challenge: %q", challenge)
+}
+
+// default token lifetime, if token server does not report it
+const defaultTokenExpiry = 60 * time.Second
+
+// cached registry token
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// token get registry token for repository pull scope: cached, until it expires, or from token server (realm)
+func (c *Client) token(repo *Repository, params map[string]string) (string, error) {
+	key := strings.Join([]string{repo.URL, repo.Name, repo.Username, params["realm"], params["service"], params["scope"]}, "|")
+	c.mu.Lock()
+	cached, ok := c.tokens[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.token, nil
+	}
+	token, expiresIn, err := c.fetchToken(repo, params)
+	if err != nil {
+		return "", err
+	}
+	// refresh token a bit before it expires
+	expiry := defaultTokenExpiry
+	if expiresIn > 0 {
+		expiry = time.Duration(expiresIn) * time.Second
+	}
+	c.mu.Lock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]cachedToken)
+	}
+	c.tokens[key] = cachedToken{token: token, expires: time.Now().Add(expiry * 9 / 10)}
+	c.mu.Unlock()
+	return token, nil
+}
+
+// fetchToken get registry token and its lifetime (seconds, 0 if unknown) from token server (realm)
+func (c *Client) fetchToken(repo *Repository, params map[string]string) (string, int, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", 0, fmt.Errorf("missing realm in registry authentication challenge")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", 0, fmt.Errorf("bad registry token realm %q: %v", realm, err)
+	}
+	q := u.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", repo.Name)
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", 0, err
+	}
+	if repo.Username != "" {
+		req.SetBasicAuth(repo.Username, repo.Password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("failed to get registry token: %s", resp.Status)
+	}
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", 0, fmt.Errorf("failed to parse registry token: %v", err)
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	if t.Token == "" {
+		return "", 0, fmt.Errorf("empty registry token")
+	}
+	return t.Token, t.ExpiresIn, nil
+}
+
+// parseChallenge parse WWW-Authenticate header: scheme and key="value" parameters
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	challenge = strings.TrimSpace(challenge)
+	i := strings.IndexByte(challenge, ' ')
+	if i == -1 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			// quoted value; may contain commas (scope list)
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end == -1 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end+1:]
+			}
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Repository image repository in registry v2 API server
+	Repository struct {
+		// URL registry base URL, without "/v2/" suffix
+		URL string
+		// Name repository name (image path)
+		Name string
+		// Username registry user; anonymous access if empty
+		Username string
+		// Password registry password or token
+		Password string
+	}
+
+	// Client registry v2 API client
+	Client struct {
+		http *http.Client
+		mu   sync.Mutex
+		// tokens registry tokens by repository and scope
+		tokens map[string]cachedToken
+	}
+
+	// Descriptor OCI content descriptor
+	Descriptor struct {
+		MediaType string    `json:"mediaType"`
+		Digest    string    `json:"digest"`
+		Size      int64     `json:"size"`
+		Platform  *Platform `json:"platform,omitempty"`
+	}
+
+	// Platform image platform
+	Platform struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant,omitempty"`
+	}
+
+	// Manifest image manifest or index (manifest list)
+	Manifest struct {
+		// Digest manifest digest, reported by registry or computed from content
+		Digest       string       `json:"-"`
+		MediaType    string       `json:"mediaType"`
+		ArtifactType string       `json:"artifactType,omitempty"`
+		Config       *Descriptor  `json:"config,omitempty"`
+		Manifests    []Descriptor `json:"manifests,omitempty"`
+	}
+)
+
+// manifest media types accepted from registry
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// image config media types
+var imageConfigMediaTypes = map[string]bool{
+	"application/vnd.docker.container.image.v1+json": true,
+	"application/vnd.oci.image.config.v1+json":       true,
+}
+
+// NewClient new registry v2 API client with request timeout
+func NewClient(timeout time.Duration) *Client {
+	return &Client{http: &http.Client{Timeout: timeout}, tokens: make(map[string]cachedToken)}
+}
+
+// IsIndex check if manifest is an index (manifest list)
+func (m *Manifest) IsIndex() bool {
+	return len(m.Manifests) > 0 || strings.Contains(m.MediaType, "index") || strings.Contains(m.MediaType, "manifest.list")
+}
+
+// ArtifactMediaType artifact type of OCI artifact: manifest artifact type or non-image config media type
+func (m *Manifest) ArtifactMediaType() string {
+	if m.ArtifactType != "" {
+		return m.ArtifactType
+	}
+	if m.Config != nil && !imageConfigMediaTypes[m.Config.MediaType] {
+		return m.Config.MediaType
+	}
+	return ""
+}
+
+// Platforms index platforms as os/architecture[/variant] list; skips unknown platforms
+// (build attestations)
+func (m *Manifest) Platforms() []string {
+	var platforms []string
+	for _, d := range m.Manifests {
+		if d.Platform == nil || d.Platform.OS == "unknown" {
+			continue
+		}
+		platforms = append(platforms, d.Platform.String())
+	}
+	return platforms
+}
+
+// DefaultImage index image for default (linux/amd64) platform, first known platform image otherwise;
+// nil if there are no platform images
+func (m *Manifest) DefaultImage() *Descriptor {
+	var image *Descriptor
+	for i, d := range m.Manifests {
+		if d.Platform == nil || d.Platform.OS == "unknown" {
+			continue
+		}
+		if d.Platform.OS == "linux" && d.Platform.Architecture == "amd64" {
+			return &m.Manifests[i]
+		}
+		if image == nil {
+			image = &m.Manifests[i]
+		}
+	}
+	return image
+}
+
+// String format platform as os/architecture[/variant]
+func (p *Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Manifest get image manifest or index by tag or digest
+func (c *Client) Manifest(repo *Repository, reference string) (*Manifest, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v2/%s/manifests/%s", strings.TrimSuffix(repo.URL, "/"), repo.Name, reference), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := c.do(repo, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// manifest is limited to 4MB by registries
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err = json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s:%s manifest: %v", repo.Name, reference, err)
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	}
+	manifest.Digest = resp.Header.Get("Docker-Content-Digest")
+	if manifest.Digest == "" {
+		sum := sha256.Sum256(body)
+		manifest.Digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return &manifest, nil
+}
+
+// Blob get blob content by digest; fails if blob is larger than maxSize bytes
+func (c *Client) Blob(repo *Repository, digest string, maxSize int64) ([]byte, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/v2/%s/blobs/%s", strings.TrimSuffix(repo.URL, "/"), repo.Name, digest), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(repo, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("blob %s is too large: %d bytes", digest, resp.ContentLength)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("blob %s is too large: more than %d bytes", digest, maxSize)
+	}
+	return body, nil
+}
+
+// do send request, authenticating on registry challenge; returns successful response only
+func (c *Client) do(repo *Repository, req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err = c.authorize(repo, req, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = c.http.Do(req); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return resp, nil
+}
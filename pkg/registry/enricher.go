@@ -0,0 +1,262 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Credentials registry access for provider events from specific namespace
+	Credentials struct {
+		// Provider event provider (dockerhub, quay, jfrog, ...)
+		Provider string `json:"provider"`
+		// Namespace event namespace; any namespace if empty or "*"
+		Namespace string `json:"namespace,omitempty"`
+		// URL registry base URL; default for public registry providers
+		URL string `json:"url,omitempty"`
+		// Image repository name template with {namespace} and {name} placeholders; "{namespace}/{name}" by default
+		Image    string `json:"image,omitempty"`
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+	}
+
+	// Enricher adds manifest digest, media type and platforms to registry push events,
+	// querying registry v2 API for pushed tag
+	Enricher struct {
+		client      *Client
+		credentials []Credentials
+	}
+)
+
+// default registry URLs of public registry providers
+var defaultURLs = map[string]string{
+	"dockerhub": "https://registry-1.docker.io",
+	"quay":      "https://quay.io",
+	"ghcr":      "https://ghcr.io",
+}
+
+// LoadCredentials load registry credentials list from JSON file
+func LoadCredentials(file string) ([]Credentials, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var credentials []Credentials
+	if err = json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to parse registry credentials %s: %v", file, err)
+	}
+	for i, cred := range credentials {
+		if cred.Provider == "" {
+			return nil, fmt.Errorf("missing provider in registry credentials #%d", i)
+		}
+		if cred.URL == "" && defaultURLs[cred.Provider] == "" {
+			return nil, fmt.Errorf("missing %s registry url in registry credentials #%d", cred.Provider, i)
+		}
+	}
+	return credentials, nil
+}
+
+// NewEnricher new registry enricher for events matching credentials
+func NewEnricher(credentials []Credentials, timeout time.Duration) *Enricher {
+	return &Enricher{client: NewClient(timeout), credentials: credentials}
+}
+
+// Repository get registry repository of event; nil if there are no matching credentials
+func (e *Enricher) Repository(event *hermes.NormalizedEvent) *Repository {
+	var found *Credentials
+	for i, cred := range e.credentials {
+		if cred.Provider != event.Variables["provider"] {
+			continue
+		}
+		if cred.Namespace == event.Variables["namespace"] {
+			found = &e.credentials[i]
+			break
+		}
+		if found == nil && (cred.Namespace == "" || cred.Namespace == "*") {
+			found = &e.credentials[i]
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	repo := &Repository{
+		URL:      found.URL,
+		Name:     found.Image,
+		Username: found.Username,
+		Password: found.Password,
+	}
+	if repo.URL == "" {
+		repo.URL = defaultURLs[found.Provider]
+	}
+	if repo.Name == "" {
+		repo.Name = "{namespace}/{name}"
+	}
+	repo.Name = strings.NewReplacer("{namespace}", event.Variables["namespace"], "{name}", event.Variables["name"]).Replace(repo.Name)
+	return repo
+}
+
+// Enrich add digest, media_type, artifact_type, platforms and label_* variables to registry push event;
+// variables set by provider are kept. Image config labels are filtered by "labels" endpoint query parameter.
+func (e *Enricher) Enrich(event *hermes.NormalizedEvent, query url.Values) error {
+	tag := event.Variables["tag"]
+	if event.Variables["type"] != "registry" || tag == "" || event.Variables["action"] == "delete" {
+		return nil
+	}
+	allowlist := ParseLabels(query.Get("labels"))
+	if event.Variables["digest"] != "" && event.Variables["media_type"] != "" && event.Variables["platforms"] != "" && len(allowlist) == 0 {
+		return nil
+	}
+	repo := e.Repository(event)
+	if repo == nil {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"registry": repo.URL,
+		"image":    repo.Name,
+		"tag":      tag,
+	}).Debug("Getting image manifest")
+
+	manifest, err := e.client.Manifest(repo, tag)
+	if err != nil {
+		return err
+	}
+	setDefault(event, "digest", manifest.Digest)
+	setDefault(event, "media_type", manifest.MediaType)
+	setDefault(event, "artifact_type", manifest.ArtifactMediaType())
+	if manifest.IsIndex() {
+		setDefault(event, "platforms", strings.Join(manifest.Platforms(), ","))
+		// image labels are taken from default platform image
+		child := manifest.DefaultImage()
+		if len(allowlist) == 0 || child == nil {
+			return nil
+		}
+		if manifest, err = e.client.Manifest(repo, child.Digest); err != nil {
+			return err
+		}
+	} else if event.Variables["platforms"] != "" && len(allowlist) == 0 {
+		return nil
+	}
+	if manifest.Config == nil || !imageConfigMediaTypes[manifest.Config.MediaType] {
+		return nil
+	}
+
+	config, err := e.imageConfig(repo, manifest)
+	if err != nil {
+		return err
+	}
+	if config.OS != "" {
+		platform := Platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}
+		setDefault(event, "platforms", platform.String())
+	}
+	addLabels(event, config.Config.Labels, allowlist)
+	return nil
+}
+
+// image config platform and labels
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// image config blob size limit
+const maxConfigSize = 1 << 20
+
+func (e *Enricher) imageConfig(repo *Repository, manifest *Manifest) (*imageConfig, error) {
+	data, err := e.client.Blob(repo, manifest.Config.Digest, maxConfigSize)
+	if err != nil {
+		return nil, err
+	}
+	var config imageConfig
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s image config: %v", repo.Name, err)
+	}
+	return &config, nil
+}
+
+// DefaultLabels image config labels added as event variables, unless endpoint sets its own allowlist
+var DefaultLabels = []string{
+	"org.opencontainers.image.revision",
+	"org.opencontainers.image.source",
+	"org.opencontainers.image.version",
+}
+
+// label value and total labels size limits, in bytes
+const (
+	maxLabelSize  = 1024
+	maxLabelsSize = 8192
+)
+
+// ParseLabels parse comma separated label keys allowlist; key may end with '*' to match key prefix;
+// default labels if empty, no labels if "none"
+func ParseLabels(list string) []string {
+	switch strings.TrimSpace(list) {
+	case "":
+		return DefaultLabels
+	case "none":
+		return nil
+	}
+	var labels []string
+	for _, l := range strings.Split(list, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			labels = append(labels, l)
+		}
+	}
+	return labels
+}
+
+// LabelVariable event variable name for label key: "label_" prefix and key with non alphanumeric
+// characters replaced by '_'
+func LabelVariable(key string) string {
+	return "label_" + invalidVariableChars.ReplaceAllString(key, "_")
+}
+
+var invalidVariableChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// add allowed labels, in key order, skipping too large values and labels over total size limit
+func addLabels(event *hermes.NormalizedEvent, labels map[string]string, allowlist []string) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if allowed(k, allowlist) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	size := 0
+	for _, k := range keys {
+		v := labels[k]
+		if len(v) > maxLabelSize || size+len(v) > maxLabelsSize {
+			log.WithField("label", k).Warn("Skip image label: size limit exceeded")
+			continue
+		}
+		size += len(v)
+		setDefault(event, LabelVariable(k), v)
+	}
+}
+
+func allowed(key string, allowlist []string) bool {
+	for _, a := range allowlist {
+		if a == key || (strings.HasSuffix(a, "*") && strings.HasPrefix(key, strings.TrimSuffix(a, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func setDefault(event *hermes.NormalizedEvent, key, value string) {
+	if event.Variables[key] == "" && value != "" {
+		event.Variables[key] = value
+	}
+}
@@ -0,0 +1,398 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/nomios/pkg/hermes"
+)
+
+// fake registry v2 API server with token authentication
+type fakeRegistry struct {
+	*httptest.Server
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	// tokens token requests
+	tokens int32
+}
+
+const (
+	fakeToken = "FAKE-TOKEN"
+	indexType = "application/vnd.oci.image.index.v1+json"
+	imageType = "application/vnd.oci.image.manifest.v1+json"
+)
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func newFakeRegistry() *fakeRegistry {
+	r := &fakeRegistry{manifests: make(map[string][]byte), blobs: make(map[string][]byte)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&r.tokens, 1)
+		user, pass, ok := req.BasicAuth()
+		if !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("service") != "fake" || !strings.HasPrefix(req.URL.Query().Get("scope"), "repository:team/app:pull") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"token": %q}`, fakeToken)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer "+fakeToken {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:team/app:pull"`, r.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := strings.TrimPrefix(req.URL.Path, "/v2/team/app/")
+		switch {
+		case strings.HasPrefix(path, "manifests/"):
+			data, ok := r.manifests[strings.TrimPrefix(path, "manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var m Manifest
+			json.Unmarshal(data, &m)
+			w.Header().Set("Content-Type", m.MediaType)
+			w.Header().Set("Docker-Content-Digest", digestOf(data))
+			w.Write(data)
+		case strings.HasPrefix(path, "blobs/"):
+			data, ok := r.blobs[strings.TrimPrefix(path, "blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	r.Server = httptest.NewServer(mux)
+	return r
+}
+
+// push image with config, returns manifest
+func (r *fakeRegistry) pushImage(tag string, config string) []byte {
+	r.blobs[digestOf([]byte(config))] = []byte(config)
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":%q,"size":%d},"layers":[]}`,
+		imageType, digestOf([]byte(config)), len(config))
+	r.manifests[tag] = []byte(manifest)
+	r.manifests[digestOf([]byte(manifest))] = []byte(manifest)
+	return []byte(manifest)
+}
+
+func pushEvent(tag string) *hermes.NormalizedEvent {
+	event := hermes.NewNormalizedEvent()
+	event.Variables["provider"] = "quay"
+	event.Variables["type"] = "registry"
+	event.Variables["namespace"] = "team"
+	event.Variables["name"] = "app"
+	event.Variables["tag"] = tag
+	return event
+}
+
+func TestEnrich(t *testing.T) {
+	r := newFakeRegistry()
+	defer r.Close()
+
+	image := r.pushImage("1.0.0", `{"architecture":"arm64","os":"linux","variant":"v8"}`)
+	index := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[`+
+		`{"mediaType":%q,"digest":%q,"size":%d,"platform":{"architecture":"amd64","os":"linux"}},`+
+		`{"mediaType":%q,"digest":%q,"size":%d,"platform":{"architecture":"arm64","os":"linux","variant":"v8"}},`+
+		`{"mediaType":%q,"digest":"sha256:0000","size":1,"platform":{"architecture":"unknown","os":"unknown"}}]}`,
+		indexType, imageType, digestOf(image), len(image), imageType, digestOf(image), len(image), imageType)
+	r.manifests["multi"] = []byte(index)
+	r.blobs["sha256:helm"] = []byte(`{}`)
+	chart := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":"application/vnd.cncf.helm.config.v1+json","digest":"sha256:helm","size":2}}`, imageType)
+	r.manifests["0.3.0"] = []byte(chart)
+
+	enricher := NewEnricher([]Credentials{
+		{Provider: "dockerhub", Namespace: "team", URL: "http://invalid.host", Username: "user", Password: "pass"},
+		{Provider: "quay", Namespace: "*", URL: r.URL, Image: "{namespace}/{name}", Username: "user", Password: "pass"},
+	}, 5*time.Second)
+
+	tests := []struct {
+		name    string
+		event   *hermes.NormalizedEvent
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "image",
+			event: pushEvent("1.0.0"),
+			want: map[string]string{
+				"digest":     digestOf(image),
+				"media_type": imageType,
+				"platforms":  "linux/arm64/v8",
+			},
+		},
+		{
+			name:  "index",
+			event: pushEvent("multi"),
+			want: map[string]string{
+				"digest":     digestOf([]byte(index)),
+				"media_type": indexType,
+				"platforms":  "linux/amd64,linux/arm64/v8",
+			},
+		},
+		{
+			name:  "helm chart artifact",
+			event: pushEvent("0.3.0"),
+			want: map[string]string{
+				"digest":        digestOf([]byte(chart)),
+				"media_type":    imageType,
+				"artifact_type": "application/vnd.cncf.helm.config.v1+json",
+			},
+		},
+		{
+			name: "provider digest is kept",
+			event: func() *hermes.NormalizedEvent {
+				e := pushEvent("1.0.0")
+				e.Variables["digest"] = "sha256:provider"
+				return e
+			}(),
+			want: map[string]string{
+				"digest":     "sha256:provider",
+				"media_type": imageType,
+				"platforms":  "linux/arm64/v8",
+			},
+		},
+		{
+			name:    "unknown tag",
+			event:   pushEvent("missing"),
+			want:    map[string]string{},
+			wantErr: true,
+		},
+		{
+			name: "no credentials",
+			event: func() *hermes.NormalizedEvent {
+				e := pushEvent("1.0.0")
+				e.Variables["provider"] = "harbor"
+				return e
+			}(),
+			want: map[string]string{},
+		},
+		{
+			name: "delete event",
+			event: func() *hermes.NormalizedEvent {
+				e := pushEvent("1.0.0")
+				e.Variables["action"] = "delete"
+				return e
+			}(),
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := enricher.Enrich(tt.event, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Enrich() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := make(map[string]string)
+			for _, k := range []string{"digest", "media_type", "artifact_type", "platforms"} {
+				if v, ok := tt.event.Variables[k]; ok {
+					got[k] = v
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Enrich() variables = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnrichLabels(t *testing.T) {
+	r := newFakeRegistry()
+	defer r.Close()
+
+	image := r.pushImage("1.0.0", `{"architecture":"amd64","os":"linux","config":{"Labels":{`+
+		`"org.opencontainers.image.revision":"3f2a1b4c","org.opencontainers.image.source":"https://github.com/team/app",`+
+		`"org.opencontainers.image.version":"1.0.0","maintainer":"team@example.com","large":"`+strings.Repeat("x", 2048)+`"}}}`)
+	r.pushImage("arm", `{"architecture":"arm64","os":"linux","config":{"Labels":{"org.opencontainers.image.revision":"arm"}}}`)
+	arm := r.manifests["arm"]
+	r.manifests["multi"] = []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[`+
+		`{"mediaType":%q,"digest":%q,"size":%d,"platform":{"architecture":"arm64","os":"linux"}},`+
+		`{"mediaType":%q,"digest":%q,"size":%d,"platform":{"architecture":"amd64","os":"linux"}}]}`,
+		indexType, imageType, digestOf(arm), len(arm), imageType, digestOf(image), len(image)))
+
+	enricher := NewEnricher([]Credentials{{Provider: "quay", URL: r.URL, Username: "user", Password: "pass"}}, 5*time.Second)
+
+	tests := []struct {
+		name   string
+		tag    string
+		labels string
+		want   map[string]string
+	}{
+		{
+			name: "default labels",
+			tag:  "1.0.0",
+			want: map[string]string{
+				"label_org_opencontainers_image_revision": "3f2a1b4c",
+				"label_org_opencontainers_image_source":   "https://github.com/team/app",
+				"label_org_opencontainers_image_version":  "1.0.0",
+			},
+		},
+		{
+			name:   "allowlist",
+			tag:    "1.0.0",
+			labels: "maintainer,org.opencontainers.image.rev*",
+			want: map[string]string{
+				"label_maintainer":                        "team@example.com",
+				"label_org_opencontainers_image_revision": "3f2a1b4c",
+			},
+		},
+		{
+			name:   "size cap",
+			tag:    "1.0.0",
+			labels: "large,maintainer",
+			want: map[string]string{
+				"label_maintainer": "team@example.com",
+			},
+		},
+		{
+			name:   "no labels",
+			tag:    "1.0.0",
+			labels: "none",
+			want:   map[string]string{},
+		},
+		{
+			name:   "index default platform",
+			tag:    "multi",
+			labels: "org.opencontainers.image.revision",
+			want: map[string]string{
+				"label_org_opencontainers_image_revision": "3f2a1b4c",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := pushEvent(tt.tag)
+			if err := enricher.Enrich(event, url.Values{"labels": []string{tt.labels}}); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for k, v := range event.Variables {
+				if strings.HasPrefix(k, "label_") {
+					got[k] = v
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Enrich() labels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBadCredentials(t *testing.T) {
+	r := newFakeRegistry()
+	defer r.Close()
+	r.pushImage("1.0.0", `{"architecture":"amd64","os":"linux"}`)
+
+	client := NewClient(5 * time.Second)
+	_, err := client.Manifest(&Repository{URL: r.URL, Name: "team/app", Username: "user", Password: "wrong"}, "1.0.0")
+	if err == nil {
+		t.Error("Manifest() expected error for bad credentials")
+	}
+}
+
+func TestBlobSizeCap(t *testing.T) {
+	r := newFakeRegistry()
+	defer r.Close()
+	r.blobs["sha256:large"] = make([]byte, 2048)
+
+	client := NewClient(5 * time.Second)
+	repo := &Repository{URL: r.URL, Name: "team/app", Username: "user", Password: "pass"}
+	if _, err := client.Blob(repo, "sha256:large", 1024); err == nil {
+		t.Error("Blob() expected error for blob larger than size cap")
+	}
+	if data, err := client.Blob(repo, "sha256:large", 4096); err != nil || len(data) != 2048 {
+		t.Errorf("Blob() = %d bytes, %v", len(data), err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:team/app:pull,push"`)
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:team/app:pull,push",
+	}
+	if scheme != "Bearer" || !reflect.DeepEqual(params, want) {
+		t.Errorf("parseChallenge() = %v, %v, want Bearer, %v", scheme, params, want)
+	}
+	if scheme, _ = parseChallenge(`Basic realm="Registry"`); scheme != "Basic" {
+		t.Errorf("parseChallenge() scheme = %v, want Basic", scheme)
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	file, err := ioutil.TempFile("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`[{"provider":"dockerhub","namespace":"codefresh","username":"user","password":"pass"},{"provider":"jfrog","url":"https://acme.jfrog.io","image":"{name}"}]`)
+	file.Close()
+
+	credentials, err := LoadCredentials(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credentials) != 2 || credentials[1].Image != "{name}" {
+		t.Errorf("LoadCredentials() = %v", credentials)
+	}
+
+	ioutil.WriteFile(file.Name(), []byte(`[{"provider":"jfrog"}]`), 0600)
+	if _, err = LoadCredentials(file.Name()); err == nil {
+		t.Error("LoadCredentials() expected error for missing jfrog registry url")
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	r := newFakeRegistry()
+	defer r.Close()
+	r.pushImage("1.0", `{}`)
+	client := NewClient(time.Second)
+	repo := &Repository{URL: r.URL, Name: "team/app", Username: "user", Password: "pass"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Manifest(repo, "1.0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&r.tokens); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+
+	// expired token is fetched again
+	client.mu.Lock()
+	for key, cached := range client.tokens {
+		cached.expires = time.Now().Add(-time.Second)
+		client.tokens[key] = cached
+	}
+	client.mu.Unlock()
+	if _, err := client.Manifest(repo, "1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&r.tokens); n != 2 {
+		t.Errorf("token requests after expiry = %d, want 2", n)
+	}
+}